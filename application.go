@@ -12,9 +12,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"reflect"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,6 +29,12 @@ type Application struct {
 	//before
 	BeforeFilters []Filter
 	AfterFilters  []Filter
+	//中间件,位于before与after之间
+	Middlewares []Middleware
+	//标准库形式的中间件,包裹整个ServeHTTP
+	HttpMiddlewares []func(http.Handler) http.Handler
+	//挂载的http.Handler,按前缀索引
+	Mounts map[string]http.Handler
 	//错误处理器集合
 	ErrorHandlers map[int]Filter
 	//配置
@@ -38,11 +43,26 @@ type Application struct {
 	TplFuncs map[string]interface{}
 	//模板引擎
 	TplEngine *template.Template
+	//注册filter和中间件时记录的名字,供Routes使用
+	beforeNames, afterNames, middlewareNames []string
+	//编译后的路由树
+	router *router
+	//经过HttpMiddlewares包裹后的处理器
+	handler    http.Handler
+	routerLock sync.RWMutex
 }
 
 //初始化程序,包括模板函数和引擎的初始化
 func (self *Application) Initialize() {
-	//template functions
+	self.initTemplateFuncs()
+	self.initTemplateEngine()
+}
+
+//注册内置的模板函数,不依赖模板目录
+func (self *Application) initTemplateFuncs() {
+	if self.TplFuncs == nil {
+		self.TplFuncs = make(map[string]interface{})
+	}
 	self.TplFuncs["static"] = func(url string) string {
 		filePath := path.Join(self.AppPath, self.Setting.StaticDir, url)
 		fi, err := os.Stat(filePath)
@@ -57,26 +77,34 @@ func (self *Application) Initialize() {
 		return urlFile
 	}
 	self.TplFuncs["url"] = func(name string, arg ...interface{}) string {
-		if strings.Contains(name, ".") {
-			_tmp := strings.Split(name, ".")
-			if spec, ok := self.Blueprints[_tmp[0]].NamedHandlers[_tmp[1]]; ok {
-				url, err := spec.UrlSetParams(arg...)
-				if err != nil {
-					return err.Error()
-				} else {
-					return self.Blueprints[_tmp[0]].Prefix + url[1:]
-				}
-			}
+		host, url, err := self.reverse(name, arg...)
+		if err != nil {
+			return self.urlError(name, err)
 		}
-		if spec, ok := self.NamedHandlers[name]; ok {
-			url, err := spec.UrlSetParams(arg...)
-			if err != nil {
-				return err.Error()
-			} else {
-				return url[1:]
+		//模板中无法得知当前请求的域名,绑定了域名的处理器使用与协议无关的绝对地址
+		if host != "" {
+			return "//" + host + url
+		}
+		return url
+	}
+	//按名字提供参数: {{urlfor "user" "id" 7 "page" 2}},不属于路径的参数加入查询字符串
+	self.TplFuncs["urlfor"] = func(name string, pairs ...interface{}) string {
+		if len(pairs)%2 != 0 {
+			return self.urlError(name, errors.New("urlfor的参数必须是成对的名字和值"))
+		}
+		params := make(map[string]interface{}, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			key, ok := pairs[i].(string)
+			if !ok {
+				return self.urlError(name, fmt.Errorf("urlfor的参数名%v必须是字符串", pairs[i]))
 			}
+			params[key] = pairs[i+1]
+		}
+		url, err := self.URLFor(name, URLOptions{Params: params})
+		if err != nil {
+			return self.urlError(name, err)
 		}
-		return fmt.Sprintf("处理器 %s 没有找到", name)
+		return url
 	}
 	self.TplFuncs["empty"] = func(i interface{}) bool {
 		if i == nil {
@@ -108,7 +136,10 @@ func (self *Application) Initialize() {
 	self.TplFuncs["xsrf"] = func(ctx *Context) template.HTML {
 		return template.HTML(fmt.Sprintf(`<input type="hidden" value="%s" name=%q id=%q>`, ctx.GetXsrf(), XSRF, XSRF))
 	}
-	//构造模板引擎
+}
+
+//构造模板引擎,解析模板目录下的所有模板
+func (self *Application) initTemplateEngine() {
 	tplBasePath := path.Join(self.AppPath, self.Setting.TemplateDir)
 	dir, err := os.Stat(tplBasePath)
 	if err != nil {
@@ -139,8 +170,38 @@ func (self *Application) Initialize() {
 	})
 }
 
-//添加处理器
-func (self *Application) Handle(pattern string, eName string, cName string, handler Handler) {
+//添加处理器,接受任意HTTP方法;middlewares为只作用于该处理器的中间件
+func (self *Application) Handle(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("", pattern, eName, cName, handler, middlewares)
+}
+
+//添加只处理GET请求的处理器,HEAD请求也由它处理
+func (self *Application) Get(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("GET", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Application) Post(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("POST", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Application) Put(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("PUT", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Application) Patch(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("PATCH", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Application) Delete(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("DELETE", pattern, eName, cName, handler, middlewares)
+}
+
+//与Handle相同,接受任意HTTP方法
+func (self *Application) Any(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Application) handle(method string, pattern string, eName string, cName string, handler Handler, middlewares []Middleware) {
 	if strings.Contains(eName, ".") {
 		panic("名字里面带个点是几个意思!?")
 	}
@@ -154,162 +215,268 @@ func (self *Application) Handle(pattern string, eName string, cName string, hand
 	if _, exist := self.NamedHandlers[eName]; exist {
 		panic(fmt.Sprintf("已经有一个名叫 %s 的处理器！", eName))
 	}
-	self.NamedHandlers[eName] = NewURLSpec(pattern, handler, eName, cName)
+	spec := NewURLSpec(pattern, handler, eName, cName)
+	spec.Method = method
+	spec.Middlewares = middlewares
+	spec.mustPlan()
+	//application级别的处理器不绑定域名,参数个数必须与路径中的参数一致
+	if len(spec.plan.decoders) != len(spec.ParamNames) {
+		panic(fmt.Sprintf("处理器 %s (%s) 需要 %d 个路径参数, 但是路径中有 %d 个参数 %v",
+			eName, pattern, len(spec.plan.decoders), len(spec.ParamNames), spec.ParamNames))
+	}
+	self.NamedHandlers[eName] = spec
+	self.resetRouter()
 }
 
-func (self *Application) Before(filter Filter) {
-	self.BeforeFilters = append(self.BeforeFilters, filter)
+//添加before filter,except中的处理器不执行该filter,Blueprint中的处理器使用 bp.name 的形式
+func (self *Application) Before(filter Filter, except ...string) {
+	self.BeforeFilters = append(self.BeforeFilters, exceptFilter(filter, except, true))
+	self.beforeNames = append(self.beforeNames, funcName(filter, except))
+}
+
+//添加after filter,except的用法与Before相同
+func (self *Application) After(filter Filter, except ...string) {
+	self.AfterFilters = append(self.AfterFilters, exceptFilter(filter, except, true))
+	self.afterNames = append(self.afterNames, funcName(filter, except))
+}
+
+//添加中间件,except的用法与Before相同
+func (self *Application) Around(middleware Middleware, except ...string) {
+	self.Middlewares = append(self.Middlewares, exceptMiddleware(middleware, except, true))
+	self.middlewareNames = append(self.middlewareNames, funcName(middleware, except))
+}
+
+//添加标准库形式的中间件,如 func(http.Handler) http.Handler,先添加的位于最外层
+func (self *Application) Use(middleware func(http.Handler) http.Handler) {
+	self.HttpMiddlewares = append(self.HttpMiddlewares, middleware)
+	self.resetRouter()
+}
+
+//将http.Handler挂载到prefix下,转发时去掉路径中的prefix;挂载的处理器不经过filter和中间件,但出错时仍由错误处理器处理
+func (self *Application) Mount(prefix string, handler http.Handler) {
+	self.Mounts[prefix] = handler
+	self.resetRouter()
 }
 
 func (self *Application) Blueprint(name string, bp *Blueprint) {
+	if strings.Contains(name, ".") {
+		panic("名字里面带个点是几个意思!?")
+	}
 	self.Blueprints[name] = bp
+	self.resetRouter()
+}
+
+//根据名字查找处理器及其所在Blueprint的完整前缀和绑定的域名,名字形如 api.v1.users.show
+func (self *Application) findNamedHandler(name string) (spec *URLSpec, host string, prefix string, ok bool) {
+	parts := strings.Split(name, ".")
+	handlers, blueprints := self.NamedHandlers, self.Blueprints
+	for _, part := range parts[:len(parts)-1] {
+		bp, exist := blueprints[part]
+		if !exist {
+			return
+		}
+		prefix = joinPattern(prefix, bp.Prefix)
+		if bp.Host != "" {
+			host = bp.Host
+		}
+		handlers, blueprints = bp.NamedHandlers, bp.Blueprints
+	}
+	spec, ok = handlers[parts[len(parts)-1]]
+	return
+}
+
+//根据处理器的名字及参数生成url;处理器绑定了域名时同时返回域名,域名中的参数位于参数列表的最前面
+func (self *Application) reverse(name string, args ...interface{}) (string, string, error) {
+	spec, hostPattern, prefix, ok := self.findNamedHandler(name)
+	if !ok {
+		return "", "", fmt.Errorf("处理器 %s 没有找到", name)
+	}
+	host := ""
+	if hostPattern != "" {
+		hp := newHostPattern(hostPattern)
+		var err error
+		if host, err = hp.fill(args); err != nil {
+			return "", "", err
+		}
+		args = args[len(hp.Names):]
+	}
+	url, err := spec.UrlSetParams(args...)
+	if err != nil {
+		return "", "", err
+	}
+	return host, joinPattern(prefix, url), nil
+}
+
+//查找错误处理器,从处理器所在的最内层Blueprint开始向外查找,最后查找application级别的错误处理器
+func (self *Application) errorHandler(ctx *Context, code int) (Filter, bool) {
+	if ctx.route != nil {
+		for i := len(ctx.route.Blueprints) - 1; i >= 0; i-- {
+			if handler, ok := ctx.route.Blueprints[i].ErrorHandlers[code]; ok {
+				return handler, true
+			}
+		}
+	}
+	handler, ok := self.ErrorHandlers[code]
+	return handler, ok
 }
 
 //捕获http请求
 func (self *Application) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	self.getHandler().ServeHTTP(rw, req)
+}
+
+//获取经过HttpMiddlewares包裹后的处理器
+func (self *Application) getHandler() http.Handler {
+	self.routerLock.RLock()
+	h := self.handler
+	self.routerLock.RUnlock()
+	if h != nil {
+		return h
+	}
+	self.routerLock.Lock()
+	defer self.routerLock.Unlock()
+	if self.handler == nil {
+		self.handler = http.HandlerFunc(self.serve)
+		for i := len(self.HttpMiddlewares) - 1; i >= 0; i-- {
+			self.handler = self.HttpMiddlewares[i](self.handler)
+		}
+	}
+	return self.handler
+}
+
+//处理http请求
+func (self *Application) serve(rw http.ResponseWriter, req *http.Request) {
 	ctx := NewContext(self, req, rw)
 	defer func() {
 		if err := recover(); err != nil {
-			switch err {
-			case 404:
-				if handler, ok := self.ErrorHandlers[404]; ok {
-					handler(ctx)
-				}
-			case 401:
-				if handler, ok := self.ErrorHandlers[401]; ok {
+			switch code := err.(type) {
+			case int:
+				//panic(400)、panic(404)等交给对应的错误处理器,没有错误处理器时只返回状态码
+				if handler, ok := self.errorHandler(ctx, code); ok {
 					handler(ctx)
+				} else if acceptsProblem(ctx) {
+					writeProblem(ctx, NewProblem(code, ""))
+				} else {
+					ctx.Resp.WriteHeader(code)
 				}
+			case *Problem:
+				//处理器可以panic一个*Problem,直接输出为problem+json
+				writeProblem(ctx, code)
 			default:
 				if e, ok := err.(error); ok {
 					InternalServerErrorHandler(ctx, 500, e, self.Setting.Debug)
 				} else {
-					InternalServerErrorHandler(ctx, 500, errors.New(err.(string)), self.Setting.Debug)
+					InternalServerErrorHandler(ctx, 500, errors.New(fmt.Sprint(err)), self.Setting.Debug)
 				}
 
 			}
 		}
 	}()
 	rw.Header().Set("Server", EntropyVersion)
+	//在查找处理器之前清理路径中的 //、. 和 ..,并重定向到规范的路径
+	if self.Setting.CleanPath {
+		if cleaned := cleanPath(req.URL.Path); cleaned != req.URL.Path {
+			redirectPath(rw, req, cleaned)
+			return
+		}
+	}
 	//判断请求路径是否包含已经设置的静态路径
 	if strings.HasPrefix(req.URL.Path, fmt.Sprintf("/%s", self.Setting.StaticDir)) || req.URL.Path == "/favicon.ico" {
 		self.processStaticRequest(ctx)
 		return
 	}
 	//查找相符的请求处理器
-	spec, bp := self.findMatchedRequestHandler(req)
-	if spec == nil {
-		panic(404)
-	} else {
-		self.processRequestHandler(spec, bp, ctx)
-	}
-	return
-}
-
-//找到符合当前请求路径的处理器
-func (self *Application) findMatchedRequestHandler(req *http.Request) (*URLSpec, *Blueprint) {
-	for _, bp := range self.Blueprints {
-		if strings.HasPrefix(req.URL.Path, bp.Prefix) {
-			for _, spec := range bp.NamedHandlers {
-				if spec.Regex.MatchString(strings.TrimPrefix(req.URL.Path, bp.Prefix)) {
-					return spec, bp
-				}
-			}
+	rt, params, allowed := self.findMatchedRequestHandler(req)
+	if rt == nil && allowed == nil {
+		var redirected bool
+		if redirected, rt, params, allowed = self.matchTrailingSlash(rw, req); redirected {
+			return
 		}
 	}
-	for _, spec := range self.NamedHandlers {
-		requestUrl := req.URL.Path
-		if spec.Regex.MatchString(requestUrl) {
-			return spec, nil
+	ctx.route = rt
+	if rt == nil {
+		if allowed == nil {
+			panic(404)
 		}
+		//路径存在但方法不符,OPTIONS请求直接返回允许的方法,其他请求返回405
+		rw.Header().Set("Allow", strings.Join(allowed, ", "))
+		if req.Method == "OPTIONS" {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		panic(405)
+	} else if rt.Mount != nil {
+		self.processMountedHandler(rt, ctx)
+	} else {
+		self.processRequestHandler(rt, params, ctx)
 	}
-	return nil, nil
+	return
 }
 
 //处理请求
-func (self *Application) processRequestHandler(spec *URLSpec, bp *Blueprint, ctx *Context) {
+func (self *Application) processRequestHandler(rt *route, params []string, ctx *Context) {
+	spec := rt.Spec
 	ctx.HandlerName = spec.Name
 	ctx.HandlerCName = spec.CName
-	//处理request参数
-	ctx.Req.ParseForm()
-	ctx.Req.ParseMultipartForm(1 << 25) // 32M 1<< 25 /1024/1024
+	ctx.Endpoint = rt.Endpoint
+	ctx.params = make(map[string]string, len(params))
+	for i, name := range rt.ParamNames {
+		ctx.params[name] = params[i]
+	}
+	//限制请求体的大小,表单在第一次使用时才解析
+	defer ctx.limitBody(self.Setting)()
 
 	ctx.prepareSession()
 	ctx.restoreMessages()
-	//反射该处理方法
-	handler := reflect.TypeOf(spec.Handler)
-	//根据该请求的路径,将路径中的参数提取处理
-	var params []string
-	if bp != nil {
-		params = spec.ParseUrlParams(strings.TrimPrefix(ctx.Req.URL.Path, bp.Prefix))
-	} else {
-		params = spec.ParseUrlParams(ctx.Req.URL.Path)
-	}
-
-	//构造路径中的参数
-	queryArgs := make([]reflect.Value, 0)
-	//如果该方法需要的参数大于或等于1(第一个参数必须为ctx),则把路径中的参数构造好,供调用方法时使用
-	if handler.NumIn() > 1 {
-		//从1开始,把ctx过滤
-		for i := 1; i < handler.NumIn(); i++ {
-			var param interface{}
-			switch handler.In(i).Kind() {
-			case reflect.Int:
-				_tmp, _ := strconv.ParseInt(params[i-1], 10, 64)
-				param = int(_tmp)
-			case reflect.Int64:
-				param, _ = strconv.ParseInt(params[i-1], 10, 64)
-			case reflect.Float64:
-				param, _ = strconv.ParseFloat(params[i-1], 64)
-			default:
-				param = params[i-1]
-			}
-			queryArgs = append(queryArgs, reflect.ValueOf(param))
-		}
+	//根据注册时生成的调用计划,将路径中的参数转换为处理器需要的类型
+	queryArgs, index, err := spec.plan.decode(params)
+	if err != nil {
+		//路径中的参数无法转换为处理器需要的类型,返回400
+		ctx.Err = fmt.Errorf("参数 %s 的值 %q 无效: %v", rt.ParamNames[index], params[index], err)
+		panic(400)
 	}
-	//执行应用级别的before
-	for _, before := range self.BeforeFilters {
-		b, r := before(ctx)
-		if !b {
-			r.Execute(ctx.Resp)
-		}
+	//中间件的执行顺序:application级别在外,Blueprint级别由外向内,处理器自己的中间件在最内层,详见middleware.go
+	chain := filterChain(self.BeforeFilters, self.Middlewares, self.AfterFilters)
+	for _, bp := range rt.Blueprints {
+		chain = append(chain, filterChain(bp.BeforeFilters, bp.Middlewares, bp.AfterFilters)...)
 	}
-	//如果该处理器位于Blueprint下,还要优先执行Blueprint的before
-	if bp != nil {
-		for _, before := range bp.BeforeFilters {
-			b, r := before(ctx)
-			if !b {
-				r.Execute(ctx.Resp)
-			}
-		}
+	chain = append(chain, spec.Middlewares...)
+	result := runMiddlewares(ctx, chain, func() Result {
+		//调用方法,获取返回值 Result
+		return spec.plan.call(ctx, queryArgs)
+	})
+	ctx.flushSession()
+	//文件和流自行处理整个响应,flash消息留给下一个页面
+	if _, ok := result.(rawResult); !ok {
+		ctx.flushMessage()
+		ctx.generateXsrf()
 	}
-	//调用方法时需要提供的参数
-	args := make([]reflect.Value, 0)
-	//第一个参数必须是ctx
-	args = append(args, reflect.ValueOf(ctx))
-	//后续路径中的参数
-	args = append(args, queryArgs...)
-	//调用方法,获取第一个返回值 Result
-	result := reflect.ValueOf(spec.Handler).Call(args)[0].Interface().(Result)
-	if bp != nil {
-		for _, after := range bp.AfterFilters {
-			b, r := after(ctx)
-			if !b {
-				r.Execute(ctx.Resp)
-			}
+	//调用result的execute方法,进行输出;中间件可能已经自行输出,此时Result为nil.
+	//Result返回的错误交给InternalServerErrorHandler处理
+	if result != nil {
+		if err := result.Execute(ctx); err != nil {
+			panic(err)
 		}
 	}
-	//执行应用级别的after
-	for _, after := range self.AfterFilters {
-		b, r := after(ctx)
-		if !b {
-			r.Execute(ctx.Resp)
-		}
+}
+
+//将请求转发给挂载的http.Handler,去掉路径中的前缀
+func (self *Application) processMountedHandler(rt *route, ctx *Context) {
+	//前缀本身重定向到前缀/,挂载的处理器(如http.FileServer)生成的相对链接才能正确解析
+	if ctx.Req.URL.Path == rt.MountPrefix {
+		redirectPath(ctx.Resp, ctx.Req, rt.MountPrefix+"/")
+		return
 	}
-	ctx.flushSession()
-	ctx.flushMessage()
-	ctx.generateXsrf()
-	//调用result的execute方法,进行输出
-	result.Execute(ctx.Resp)
+	req := new(http.Request)
+	*req = *ctx.Req
+	u := *ctx.Req.URL
+	u.Path = strings.TrimPrefix(u.Path, rt.MountPrefix)
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	u.RawPath = ""
+	req.URL = &u
+	rt.Mount.ServeHTTP(ctx.Resp, req)
 }
 
 //处理静态文件
@@ -317,17 +484,28 @@ func (self *Application) processStaticRequest(ctx *Context) {
 	//e.appPath=x://path_to_app req.Url.Path=/<e.Config.StaticDir>/css/style.css
 	//静态文件的硬盘路径
 	filePath := path.Join(self.AppPath, ctx.Req.URL.Path)
-	_, err := os.Stat(filePath)
+	fi, err := os.Stat(filePath)
 	if err != nil {
 		//不存在则404错误
 		panic(404)
 	}
+	//客户端接受时优先使用旁边预先压缩的.br或.gz文件
+	if fi.Mode().IsRegular() {
+		if encoding, compressed := precompressedFile(ctx.Resp, filePath, ctx.Req.Header.Get("Accept-Encoding")); compressed != "" {
+			if servePrecompressed(ctx, filePath, encoding, compressed) {
+				return
+			}
+		}
+	}
 	//直接使用ServeFile方法来处理静态文件
 	http.ServeFile(ctx.Resp, ctx.Req, path.Join(self.AppPath, ctx.Req.URL.Path))
 }
 
 //运行程序
 func (self *Application) Go(host string, port int) {
+	if err := self.Compile(); err != nil {
+		log.Fatalln(err)
+	}
 	addr := fmt.Sprintf("%s:%d", host, port)
 	go func() {
 		fmt.Println("Server is listening at ", addr)
@@ -344,6 +522,8 @@ func NewApplication(filePath string) *Application {
 		Blueprints:    make(map[string]*Blueprint),
 		BeforeFilters: make([]Filter, 0),
 		AfterFilters:  make([]Filter, 0),
+		Middlewares:   make([]Middleware, 0),
+		Mounts:        make(map[string]http.Handler),
 		ErrorHandlers: ErrHandlers, //定义在error.go中
 		Setting:       NewSetting(filePath),
 		TplFuncs:      make(map[string]interface{}),
@@ -0,0 +1,177 @@
+package entropy
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+//路径或域名中名为name的参数,不存在时返回空字符串
+func (self *Context) Param(name string) string {
+	return self.params[name]
+}
+
+//查询字符串中名为name的第一个值,不存在时返回defaultValue
+func (self *Context) Query(name, defaultValue string) string {
+	return argString(self.Req.URL.Query(), name, defaultValue)
+}
+
+//查询字符串中名为name的全部值
+func (self *Context) QueryStrings(name string) []string {
+	return self.Req.URL.Query()[name]
+}
+
+//以下Query*方法在参数不存在或为空时返回默认值,无法转换时返回默认值和错误
+func (self *Context) QueryInt(name string, defaultValue int) (int, error) {
+	i, err := argInt(self.Req.URL.Query(), name, int64(defaultValue), strconv.IntSize)
+	return int(i), err
+}
+
+func (self *Context) QueryInt64(name string, defaultValue int64) (int64, error) {
+	return argInt(self.Req.URL.Query(), name, defaultValue, 64)
+}
+
+func (self *Context) QueryFloat(name string, defaultValue float64) (float64, error) {
+	return argFloat(self.Req.URL.Query(), name, defaultValue)
+}
+
+func (self *Context) QueryBool(name string, defaultValue bool) (bool, error) {
+	return argBool(self.Req.URL.Query(), name, defaultValue)
+}
+
+//layout为空时使用RFC3339
+func (self *Context) QueryTime(name, layout string, defaultValue time.Time) (time.Time, error) {
+	return argTime(self.Req.URL.Query(), name, layout, defaultValue)
+}
+
+//请求体中名为name的第一个值,不读取查询字符串,不存在时返回defaultValue
+func (self *Context) FormString(name, defaultValue string) string {
+	return argString(self.bodyValues(), name, defaultValue)
+}
+
+//请求体中名为name的全部值
+func (self *Context) FormStrings(name string) []string {
+	return self.bodyValues()[name]
+}
+
+//以下Form*方法只读取请求体,规则与Query*相同
+func (self *Context) FormInt(name string, defaultValue int) (int, error) {
+	i, err := argInt(self.bodyValues(), name, int64(defaultValue), strconv.IntSize)
+	return int(i), err
+}
+
+func (self *Context) FormInt64(name string, defaultValue int64) (int64, error) {
+	return argInt(self.bodyValues(), name, defaultValue, 64)
+}
+
+func (self *Context) FormFloat(name string, defaultValue float64) (float64, error) {
+	return argFloat(self.bodyValues(), name, defaultValue)
+}
+
+func (self *Context) FormBool(name string, defaultValue bool) (bool, error) {
+	return argBool(self.bodyValues(), name, defaultValue)
+}
+
+func (self *Context) FormTime(name, layout string, defaultValue time.Time) (time.Time, error) {
+	return argTime(self.bodyValues(), name, layout, defaultValue)
+}
+
+//请求体中的表单数据,包括multipart表单中的普通字段;请求体无法解析时返回空的集合
+func (self *Context) bodyValues() url.Values {
+	values, _ := self.parseBody()
+	return values
+}
+
+//第一次使用时解析请求体中的表单数据,请求体超出大小限制时返回413
+func (self *Context) parseBody() (url.Values, error) {
+	if self.Req.MultipartForm != nil {
+		return self.Req.MultipartForm.Value, nil
+	}
+	maxMemory := self.maxMemory
+	if maxMemory <= 0 {
+		maxMemory = defaultMaxMemory
+	}
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(self.Req.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		err = self.Req.ParseMultipartForm(maxMemory)
+	} else {
+		err = self.Req.ParseForm()
+	}
+	if isBodyTooLarge(err) {
+		self.Err = err
+		panic(413)
+	}
+	if err != nil {
+		return url.Values{}, fmt.Errorf("无法解析表单: %v", err)
+	}
+	if self.Req.MultipartForm != nil {
+		return self.Req.MultipartForm.Value, nil
+	}
+	return self.Req.PostForm, nil
+}
+
+func argString(values url.Values, name, defaultValue string) string {
+	if v, ok := values[name]; ok && len(v) > 0 {
+		return v[0]
+	}
+	return defaultValue
+}
+
+func argInt(values url.Values, name string, defaultValue int64, bits int) (int64, error) {
+	value := values.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.ParseInt(value, 10, bits)
+	if err != nil {
+		return defaultValue, fmt.Errorf("参数 %s 的值 %q 不是有效的整数", name, value)
+	}
+	return i, nil
+}
+
+func argFloat(values url.Values, name string, defaultValue float64) (float64, error) {
+	value := values.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue, fmt.Errorf("参数 %s 的值 %q 不是有效的数字", name, value)
+	}
+	return f, nil
+}
+
+//除strconv.ParseBool支持的值外,on/yes/off/no也可以使用,以兼容html中的复选框
+func argBool(values url.Values, name string, defaultValue bool) (bool, error) {
+	value := values.Get(name)
+	switch value {
+	case "":
+		return defaultValue, nil
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("参数 %s 的值 %q 不是有效的布尔值", name, value)
+	}
+	return b, nil
+}
+
+func argTime(values url.Values, name, layout string, defaultValue time.Time) (time.Time, error) {
+	value := values.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("参数 %s 的值 %q 不是 %s 格式的时间", name, value, layout)
+	}
+	return t, nil
+}
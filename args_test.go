@@ -0,0 +1,52 @@
+package entropy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryAndFormArgs(t *testing.T) {
+	req := httptest.NewRequest("POST", "/?page=3&ratio=0.5&debug=on&tag=a&tag=b&since=2014-05-01&bad=x", strings.NewReader("page=9&agree=true"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx := &Context{Req: req, params: map[string]string{"id": "7"}}
+	if !ctx.HasQueryArgs() || ctx.Param("id") != "7" {
+		t.Fatal("unexpected query args or path param")
+	}
+	if page, err := ctx.QueryInt("page", 1); err != nil || page != 3 {
+		t.Fatalf("%v %v", page, err)
+	}
+	if size, err := ctx.QueryInt64("size", 20); err != nil || size != 20 {
+		t.Fatalf("%v %v", size, err)
+	}
+	if bad, err := ctx.QueryInt("bad", 5); err == nil || bad != 5 {
+		t.Fatalf("expected the default and an error, got %v %v", bad, err)
+	}
+	if ratio, err := ctx.QueryFloat("ratio", 0); err != nil || ratio != 0.5 {
+		t.Fatalf("%v %v", ratio, err)
+	}
+	if debug, err := ctx.QueryBool("debug", false); err != nil || !debug {
+		t.Fatalf("%v %v", debug, err)
+	}
+	if since, err := ctx.QueryTime("since", "2006-01-02", time.Time{}); err != nil || since.Month() != time.May {
+		t.Fatalf("%v %v", since, err)
+	}
+	if tags := ctx.QueryStrings("tag"); strings.Join(tags, ",") != "a,b" {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+	if page, err := ctx.FormInt("page", 1); err != nil || page != 9 {
+		t.Fatalf("expected the body value, got %v %v", page, err)
+	}
+	if agree, err := ctx.FormBool("agree", false); err != nil || !agree {
+		t.Fatalf("%v %v", agree, err)
+	}
+	if ratio := ctx.FormString("ratio", "none"); ratio != "none" {
+		t.Fatalf("Form* should not read the query string, got %q", ratio)
+	}
+
+	ctx = &Context{Req: httptest.NewRequest("GET", "/", nil)}
+	if ctx.HasQueryArgs() {
+		t.Fatal("expected no query args")
+	}
+}
@@ -0,0 +1,260 @@
+package entropy
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+//绑定时使用的标签,按优先级从低到高排列:后面的来源覆盖前面的来源
+var bindTags = []string{"query", "form", "path"}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//Bind产生的字段级错误,格式与Form.Errors()相同:字段名 -> 错误信息列表
+type BindErrors map[string][]string
+
+func (self BindErrors) Error() string {
+	names := make([]string, 0, len(self))
+	for name := range self {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, name+": "+strings.Join(self[name], ", "))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (self BindErrors) Errors() map[string][]string {
+	return self
+}
+
+func (self BindErrors) add(name, msg string) {
+	self[name] = append(self[name], msg)
+}
+
+/*将请求中的数据绑定到结构体,dst必须是结构体指针.
+根据Content-Type解析JSON或XML请求体,然后依次使用查询参数、表单(包括multipart)和路径参数填充字段:
+
+	type Query struct {
+		ID    int       `path:"id"`
+		Page  *int      `query:"page"`
+		Tags  []string  `query:"tag"`
+		Since time.Time `query:"since" time:"2006-01-02"`
+		Owner struct {
+			Name string `form:"name"`
+		} `form:"owner"`
+	}
+
+嵌套结构体的标签作为子字段名字的前缀,如 owner.name;没有标签的嵌套结构体直接展开.
+字段的值无法转换时返回BindErrors,请求体无法解析时返回普通的错误
+*/
+func (self *Context) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Bind的参数必须是结构体指针, 而不是 %T", dst)
+	}
+	sources, err := self.bindSources(dst)
+	if err != nil {
+		return err
+	}
+	errs := make(BindErrors)
+	bindStruct(v.Elem(), "", sources, errs, make(map[reflect.Type]bool))
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//解析请求体,返回各个标签对应的数据
+func (self *Context) bindSources(dst interface{}) (map[string]map[string][]string, error) {
+	sources := map[string]map[string][]string{
+		"query": self.Req.URL.Query(),
+		"path":  make(map[string][]string),
+	}
+	for name, value := range self.params {
+		sources["path"][name] = []string{value}
+	}
+	contentType, _, _ := mime.ParseMediaType(self.Req.Header.Get("Content-Type"))
+	switch {
+	case contentType == "application/json" || strings.HasSuffix(contentType, "+json"):
+		if err := json.NewDecoder(self.Req.Body).Decode(dst); err != nil && err != io.EOF {
+			if isBodyTooLarge(err) {
+				self.Err = err
+				panic(413)
+			}
+			return nil, fmt.Errorf("无法解析JSON请求体: %v", err)
+		}
+	case contentType == "application/xml" || contentType == "text/xml" || strings.HasSuffix(contentType, "+xml"):
+		if err := xml.NewDecoder(self.Req.Body).Decode(dst); err != nil && err != io.EOF {
+			if isBodyTooLarge(err) {
+				self.Err = err
+				panic(413)
+			}
+			return nil, fmt.Errorf("无法解析XML请求体: %v", err)
+		}
+	default:
+		form, err := self.parseBody()
+		if err != nil {
+			return nil, err
+		}
+		sources["form"] = form
+	}
+	return sources, nil
+}
+
+//按标签填充结构体的字段,prefix为嵌套结构体的前缀,返回是否有字段在数据中出现.
+//visiting记录当前路径上的结构体类型:没有标签的自引用字段(如 Parent *Node)会重复使用同样的键,不再进入;
+//带标签的嵌套结构体只在数据中有对应前缀的键时才进入,nil指针只在有字段被绑定时才分配
+func bindStruct(v reflect.Value, prefix string, sources map[string]map[string][]string, errs BindErrors, visiting map[reflect.Type]bool) bool {
+	t := v.Type()
+	//同一类型可能在路径上出现多次(带不同的前缀),只由最外层的一次负责删除
+	if !visiting[t] {
+		visiting[t] = true
+		defer delete(visiting, t)
+	}
+	bound := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		names := make(map[string]string)
+		for _, tag := range bindTags {
+			if name := field.Tag.Get(tag); name != "" {
+				names[tag] = name
+			}
+		}
+		if names["query"] == "-" || names["form"] == "-" || names["path"] == "-" {
+			continue
+		}
+		ft := indirectType(field.Type)
+		if isBindable(ft) {
+			childPrefix := prefix
+			for _, tag := range bindTags {
+				if name, ok := names[tag]; ok {
+					childPrefix = prefix + name + "."
+				}
+			}
+			if childPrefix == prefix && visiting[ft] {
+				continue
+			}
+			if childPrefix != prefix && !hasKeyPrefix(sources, childPrefix) {
+				continue
+			}
+			if fv.Kind() == reflect.Ptr && fv.IsNil() {
+				child := reflect.New(ft)
+				if bindStruct(child.Elem(), childPrefix, sources, errs, visiting) {
+					fv.Set(child)
+					bound = true
+				}
+				continue
+			}
+			if fv.Kind() == reflect.Ptr {
+				fv = fv.Elem()
+			}
+			if bindStruct(fv, childPrefix, sources, errs, visiting) {
+				bound = true
+			}
+			continue
+		}
+		for _, tag := range bindTags {
+			name, ok := names[tag]
+			if !ok {
+				continue
+			}
+			key := prefix + name
+			if values, exist := sources[tag][key]; exist && len(values) > 0 {
+				bound = true
+				if err := bindField(fv, field, values); err != nil {
+					errs.add(key, err.Error())
+				}
+			}
+		}
+	}
+	return bound
+}
+
+//数据中是否有以prefix开头的键
+func hasKeyPrefix(sources map[string]map[string][]string, prefix string) bool {
+	for _, source := range sources {
+		for key := range source {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//将字符串值转换后赋给字段,切片使用全部的值,其余类型使用第一个值;非字符串类型的空值被忽略
+func bindField(v reflect.Value, field reflect.StructField, values []string) error {
+	t := field.Type
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(t, 0, len(values))
+		for _, value := range values {
+			elem, err := bindValue(t.Elem(), field, value)
+			if err != nil {
+				return err
+			}
+			if elem.IsValid() {
+				slice = reflect.Append(slice, elem)
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	elem, err := bindValue(t, field, values[0])
+	if err != nil {
+		return err
+	}
+	if elem.IsValid() {
+		v.Set(elem)
+	}
+	return nil
+}
+
+//转换一个值,指针类型会分配新的值;返回无效的reflect.Value表示忽略该值
+func bindValue(t reflect.Type, field reflect.StructField, value string) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		elem, err := bindValue(t.Elem(), field, value)
+		if err != nil || !elem.IsValid() {
+			return elem, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+	if value == "" && t.Kind() != reflect.String {
+		return reflect.Value{}, nil
+	}
+	if t == timeType {
+		layout := field.Tag.Get("time")
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		tm, err := time.Parse(layout, value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("值 %q 不是 %s 格式的时间", value, layout)
+		}
+		return reflect.ValueOf(tm), nil
+	}
+	decoder, err := newParamDecoder(t)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	v, err := decoder(value)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("值 %q 无效", value)
+	}
+	return v, nil
+}
@@ -0,0 +1,91 @@
+package entropy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindOwner struct {
+	Name string `form:"name"`
+}
+
+type bindTarget struct {
+	ID     int       `path:"id"`
+	Page   *int      `query:"page"`
+	Tags   []string  `query:"tag"`
+	Since  time.Time `query:"since" time:"2006-01-02"`
+	Title  string    `form:"title" json:"title"`
+	Owner  bindOwner `form:"owner"`
+	Hidden string    `query:"-"`
+}
+
+func TestBind(t *testing.T) {
+	req := httptest.NewRequest("POST", "/posts/7?page=2&tag=a&tag=b&since=2014-05-01", strings.NewReader("title=hello&owner.name=frank"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx := &Context{Req: req, params: map[string]string{"id": "7"}}
+	var dst bindTarget
+	if err := ctx.Bind(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.ID != 7 || dst.Page == nil || *dst.Page != 2 || strings.Join(dst.Tags, ",") != "a,b" ||
+		dst.Since.Day() != 1 || dst.Title != "hello" || dst.Owner.Name != "frank" {
+		t.Fatalf("unexpected result %+v", dst)
+	}
+
+	req = httptest.NewRequest("POST", "/posts/7?page=x&since=yesterday", strings.NewReader(`{"title":"json"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	ctx = &Context{Req: req}
+	dst = bindTarget{}
+	err := ctx.Bind(&dst)
+	errs, ok := err.(BindErrors)
+	if !ok || len(errs.Errors()["page"]) != 1 || len(errs.Errors()["since"]) != 1 {
+		t.Fatalf("expected field errors for page and since, got %v", err)
+	}
+	if dst.Title != "json" {
+		t.Fatalf("expected the JSON body to be bound, got %+v", dst)
+	}
+}
+
+func TestHandlerBindsStruct(t *testing.T) {
+	app := newTestApplication()
+	app.Post("/posts/int:id", "update", "", func(ctx *Context, id int, form *bindTarget) Result {
+		return NewTextResult(ctx, form.Title+":"+strings.Join(form.Tags, ","))
+	})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/posts/7?tag=a", strings.NewReader("title=hello"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	app.ServeHTTP(rec, req)
+	if rec.Body.String() != "hello:a" {
+		t.Fatalf("unexpected response %q", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("POST", "/posts/7?page=x", nil))
+	if rec.Code != 400 {
+		t.Fatalf("expected 400 for an invalid field, got %d", rec.Code)
+	}
+}
+
+type bindNode struct {
+	Name   string    `query:"name"`
+	Parent *bindNode `query:"parent"`
+	Next   *bindNode
+}
+
+func TestBindSelfReference(t *testing.T) {
+	ctx := &Context{Req: httptest.NewRequest("GET", "/?name=a&parent.name=b", nil)}
+	var dst bindNode
+	if err := ctx.Bind(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Name != "a" || dst.Parent == nil || dst.Parent.Name != "b" || dst.Parent.Parent != nil || dst.Next != nil {
+		t.Fatalf("unexpected result %+v", dst)
+	}
+	//没有数据时不分配嵌套的指针
+	ctx = &Context{Req: httptest.NewRequest("GET", "/", nil)}
+	dst = bindNode{}
+	if err := ctx.Bind(&dst); err != nil || dst.Parent != nil {
+		t.Fatalf("unexpected result %+v %v", dst, err)
+	}
+}
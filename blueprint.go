@@ -2,14 +2,27 @@ package entropy
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 )
 
 type Blueprint struct {
+	//绑定的域名,如 admin.example.com 或 {tenant}.example.com,为空时继承父Blueprint的域名;
+	//域名中的参数位于路径参数之前传给处理器
+	Host          string
 	Prefix        string
 	BeforeFilters []Filter
 	NamedHandlers map[string]*URLSpec
 	AfterFilters  []Filter
+	Middlewares   []Middleware
+	//挂载的http.Handler,按前缀索引,前缀相对于Blueprint的前缀
+	Mounts map[string]http.Handler
+	//子Blueprint,继承父Blueprint的前缀、filter、中间件和错误处理器
+	Blueprints map[string]*Blueprint
+	//错误处理器,优先于父Blueprint及application的错误处理器
+	ErrorHandlers map[int]Filter
+	//注册filter和中间件时记录的名字,供Routes使用
+	beforeNames, afterNames, middlewareNames []string
 }
 
 func NewBlueprint(prefix string) *Blueprint {
@@ -18,18 +31,76 @@ func NewBlueprint(prefix string) *Blueprint {
 		BeforeFilters: make([]Filter, 0),
 		NamedHandlers: make(map[string]*URLSpec, 0),
 		AfterFilters:  make([]Filter, 0),
+		Middlewares:   make([]Middleware, 0),
+		Mounts:        make(map[string]http.Handler),
+		Blueprints:    make(map[string]*Blueprint),
+		ErrorHandlers: make(map[int]Filter),
 	}
 }
 
-func (self *Blueprint) Before(filter Filter) {
-	self.BeforeFilters = append(self.BeforeFilters, filter)
+//添加before filter,except中的处理器不执行该filter
+func (self *Blueprint) Before(filter Filter, except ...string) {
+	self.BeforeFilters = append(self.BeforeFilters, exceptFilter(filter, except, false))
+	self.beforeNames = append(self.beforeNames, funcName(filter, except))
 }
 
-func (self *Blueprint) After(filter Filter) {
-	self.AfterFilters = append(self.AfterFilters, filter)
+func (self *Blueprint) After(filter Filter, except ...string) {
+	self.AfterFilters = append(self.AfterFilters, exceptFilter(filter, except, false))
+	self.afterNames = append(self.afterNames, funcName(filter, except))
 }
 
-func (self *Blueprint) Handle(pattern string, eName string, cName string, handler Handler) {
+//添加中间件
+func (self *Blueprint) Around(middleware Middleware, except ...string) {
+	self.Middlewares = append(self.Middlewares, exceptMiddleware(middleware, except, false))
+	self.middlewareNames = append(self.middlewareNames, funcName(middleware, except))
+}
+
+//添加子Blueprint,其处理器的名字为 父名字.子名字.处理器名字
+func (self *Blueprint) Blueprint(name string, child *Blueprint) {
+	if strings.Contains(name, ".") {
+		panic(fmt.Sprintf("Blueprint name %s must not contain a dot", name))
+	}
+	self.Blueprints[name] = child
+}
+
+//将http.Handler挂载到Blueprint前缀下的prefix,转发时去掉完整的前缀
+func (self *Blueprint) Mount(prefix string, handler http.Handler) {
+	self.Mounts[prefix] = handler
+}
+
+//添加处理器,接受任意HTTP方法
+func (self *Blueprint) Handle(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Blueprint) Get(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("GET", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Blueprint) Post(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("POST", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Blueprint) Put(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("PUT", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Blueprint) Patch(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("PATCH", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Blueprint) Delete(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("DELETE", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Blueprint) Any(pattern string, eName string, cName string, handler Handler, middlewares ...Middleware) {
+	self.handle("", pattern, eName, cName, handler, middlewares)
+}
+
+func (self *Blueprint) handle(method string, pattern string, eName string, cName string, handler Handler, middlewares []Middleware) {
+	if strings.Contains(eName, ".") {
+		panic(fmt.Sprintf("Handler name %s must not contain a dot", eName))
+	}
 	//pattern:/home/str:action/int:id
 	if !strings.HasSuffix(pattern, "$") {
 		pattern = pattern + "$"
@@ -40,5 +111,9 @@ func (self *Blueprint) Handle(pattern string, eName string, cName string, handle
 	if _, exist := self.NamedHandlers[eName]; exist {
 		panic(fmt.Sprintf("Here is a handler named %s in blueprint %s", eName, self.Prefix))
 	}
-	self.NamedHandlers[eName] = NewURLSpec(pattern, handler, eName, cName)
+	spec := NewURLSpec(pattern, handler, eName, cName)
+	spec.Method = method
+	spec.Middlewares = middlewares
+	spec.mustPlan()
+	self.NamedHandlers[eName] = spec
 }
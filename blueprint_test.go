@@ -0,0 +1,49 @@
+package entropy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNestedBlueprints(t *testing.T) {
+	app := newTestApplication()
+	trace := make([]string, 0)
+	mark := func(name string) Filter {
+		return func(ctx *Context) (bool, Result) {
+			trace = append(trace, name)
+			return true, nil
+		}
+	}
+	api := NewBlueprint("/api")
+	api.Before(mark("api"))
+	api.ErrorHandlers[400] = func(ctx *Context) (bool, Result) {
+		ctx.Resp.WriteHeader(400)
+		ctx.Resp.Write([]byte("api error"))
+		return true, nil
+	}
+	v1 := NewBlueprint("/v1")
+	v1.Before(mark("v1"))
+	users := NewBlueprint("/users")
+	users.Get("/int:id", "show", "", func(ctx *Context, id int) Result {
+		return NewTextResult(ctx, ctx.Endpoint)
+	})
+	v1.Blueprint("users", users)
+	api.Blueprint("v1", v1)
+	app.Blueprint("api", api)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/3", nil))
+	if rec.Body.String() != "api.v1.users.show" || strings.Join(trace, ",") != "api,v1" {
+		t.Fatalf("unexpected response %q with filters %v", rec.Body.String(), trace)
+	}
+	if url, err := (&Context{App: app}).Reverse("api.v1.users.show", 3); err != nil || url != "/api/v1/users/3" {
+		t.Fatalf("unexpected reverse url %s", url)
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/99999999999999999999", nil))
+	if rec.Code != 400 || rec.Body.String() != "api error" {
+		t.Fatalf("expected the inherited error handler, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,366 @@
+package entropy
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+//默认压缩的内容类型,以/*结尾的表示该大类下的所有类型
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/x-javascript",
+	"application/xml",
+	"application/manifest+json",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+//服务器支持的压缩方式,按优先级排列
+var compressEncodings = []string{"br", "gzip", "deflate"}
+
+//静态文件旁边预先压缩好的文件,按优先级排列
+var precompressedExts = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+type CompressConfig struct {
+	//压缩级别,0表示各压缩方式的默认级别;gzip和deflate为1-9,brotli为0-11
+	Level int
+	//响应内容少于该字节数时不压缩,0表示使用默认的1024,负数表示总是压缩
+	MinSize int
+	//压缩的内容类型,为空时使用DefaultCompressTypes
+	Types []string
+	//启用的压缩方式,可选br、gzip和deflate,为空时全部启用
+	Encodings []string
+}
+
+//压缩器,gzip、zlib和brotli的Writer都实现了这些方法
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+//响应压缩中间件,通过Application.Use添加,静态文件、挂载的处理器和错误页面同样会被压缩.
+//根据Accept-Encoding选择压缩方式,已经设置了Content-Encoding、Content-Range的响应以及206、304等状态码不压缩
+func Compress(config CompressConfig) func(http.Handler) http.Handler {
+	if config.MinSize == 0 {
+		config.MinSize = 1024
+	}
+	if len(config.Types) == 0 {
+		config.Types = DefaultCompressTypes
+	}
+	if len(config.Encodings) == 0 {
+		config.Encodings = compressEncodings
+	}
+	pools := make(map[string]*sync.Pool)
+	for _, encoding := range config.Encodings {
+		newCompressor, err := compressorFactory(encoding, config.Level)
+		if err != nil {
+			panic(err)
+		}
+		pools[encoding] = &sync.Pool{New: func() interface{} { return newCompressor() }}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			encoding := acceptEncoding(req.Header.Get("Accept-Encoding"), config.Encodings)
+			cw := &compressWriter{ResponseWriter: rw, config: &config, encoding: encoding, pool: pools[encoding]}
+			defer cw.close()
+			next.ServeHTTP(cw, req)
+		})
+	}
+}
+
+//检查压缩方式和级别,返回创建压缩器的函数
+func compressorFactory(encoding string, level int) (func() compressor, error) {
+	switch encoding {
+	case "gzip":
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, err
+		}
+		return func() compressor {
+			w, _ := gzip.NewWriterLevel(io.Discard, level)
+			return w
+		}, nil
+	case "deflate":
+		//http中的deflate指zlib格式
+		if level == 0 {
+			level = zlib.DefaultCompression
+		}
+		if _, err := zlib.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, err
+		}
+		return func() compressor {
+			w, _ := zlib.NewWriterLevel(io.Discard, level)
+			return w
+		}, nil
+	case "br":
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			return nil, errors.New("brotli的压缩级别必须在0-11之间: " + strconv.Itoa(level))
+		}
+		return func() compressor {
+			return brotli.NewWriterLevel(io.Discard, level)
+		}, nil
+	}
+	return nil, errors.New("不支持的压缩方式: " + encoding)
+}
+
+//根据Accept-Encoding在offers中选择q值最高的压缩方式,q值相同时按offers的顺序;没有可用的方式时返回空字符串
+func acceptEncoding(header string, offers []string) string {
+	if strings.TrimSpace(header) == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qualities[name] = q
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, ok := qualities[offer]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+//内容类型是否在允许压缩的列表中
+func compressible(contentType string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+//在Vary中加入一个值,已经存在时不重复添加
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, item := range strings.Split(v, ",") {
+			item = strings.TrimSpace(item)
+			if item == "*" || strings.EqualFold(item, value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+//压缩响应的ResponseWriter.
+//内容先缓存到MinSize后才决定是否压缩并写入状态码,不足MinSize的响应原样输出;
+//调用Flush时立即决定,保证流式响应可以及时发送
+type compressWriter struct {
+	http.ResponseWriter
+	config   *CompressConfig
+	encoding string
+	pool     *sync.Pool
+	code     int
+	buf      []byte
+	decided  bool
+	writer   compressor
+}
+
+func (self *compressWriter) WriteHeader(code int) {
+	if self.decided || self.code != 0 {
+		return
+	}
+	//1xx的状态码直接发送,之后还会有最终的状态码
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		self.ResponseWriter.WriteHeader(code)
+		return
+	}
+	self.code = code
+	//没有内容的响应不需要等待
+	if code == http.StatusNoContent || code == http.StatusNotModified || code < 200 {
+		self.decide(false)
+	}
+}
+
+func (self *compressWriter) Write(p []byte) (int, error) {
+	if !self.decided {
+		if self.code == 0 {
+			self.code = http.StatusOK
+		}
+		self.buf = append(self.buf, p...)
+		if self.config.MinSize < 0 || len(self.buf) >= self.config.MinSize {
+			if err := self.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if self.writer != nil {
+		return self.writer.Write(p)
+	}
+	return self.ResponseWriter.Write(p)
+}
+
+//决定是否压缩并写入状态码和缓存的内容,large为false时表示内容不足MinSize
+func (self *compressWriter) decide(large bool) error {
+	self.decided = true
+	header := self.Header()
+	if header.Get("Content-Type") == "" && len(self.buf) > 0 {
+		//与net/http一样根据内容推断类型,避免压缩后被识别为gzip文件
+		header.Set("Content-Type", http.DetectContentType(self.buf))
+	}
+	eligible := header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		self.code != http.StatusPartialContent && self.code >= 200 &&
+		self.code != http.StatusNoContent && self.code != http.StatusNotModified &&
+		compressible(header.Get("Content-Type"), self.config.Types)
+	if eligible {
+		addVary(header, "Accept-Encoding")
+	}
+	if eligible && large && self.pool != nil {
+		header.Set("Content-Encoding", self.encoding)
+		header.Del("Content-Length")
+		//压缩后的内容与原内容不同,强ETag改为弱ETag
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		self.writer = self.pool.Get().(compressor)
+		self.writer.Reset(self.ResponseWriter)
+	}
+	self.ResponseWriter.WriteHeader(self.code)
+	buf := self.buf
+	self.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if self.writer != nil {
+		_, err = self.writer.Write(buf)
+	} else {
+		_, err = self.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (self *compressWriter) Flush() {
+	if !self.decided {
+		if self.code == 0 {
+			self.code = http.StatusOK
+		}
+		self.decide(true)
+	}
+	if self.writer != nil {
+		self.writer.Flush()
+	}
+	if flusher, ok := self.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//websocket等需要接管连接的处理器,接管后不再压缩
+func (self *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := self.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ResponseWriter不支持Hijack")
+	}
+	self.decided = true
+	return hijacker.Hijack()
+}
+
+func (self *compressWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+//请求结束时写入不足MinSize的内容,并结束压缩
+func (self *compressWriter) close() {
+	if !self.decided && self.code != 0 {
+		self.decide(false)
+	}
+	if self.writer != nil {
+		self.writer.Close()
+		self.writer.Reset(io.Discard)
+		self.pool.Put(self.writer)
+		self.writer = nil
+	}
+}
+
+//查找静态文件旁边预先压缩的.br或.gz文件,返回客户端接受的压缩方式和文件路径;
+//存在预压缩文件时设置Vary,即使这次没有使用
+func precompressedFile(rw http.ResponseWriter, filePath string, header string) (string, string) {
+	available := make(map[string]string)
+	offers := make([]string, 0, len(precompressedExts))
+	for _, p := range precompressedExts {
+		if fi, err := os.Stat(filePath + p.ext); err == nil && fi.Mode().IsRegular() {
+			available[p.encoding] = filePath + p.ext
+			offers = append(offers, p.encoding)
+		}
+	}
+	if len(offers) == 0 {
+		return "", ""
+	}
+	addVary(rw.Header(), "Accept-Encoding")
+	encoding := acceptEncoding(header, offers)
+	return encoding, available[encoding]
+}
+
+//输出预压缩的静态文件,Content-Type根据原文件的扩展名设置
+func servePrecompressed(ctx *Context, name string, encoding string, compressed string) bool {
+	f, err := os.Open(compressed)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	ctx.Resp.Header().Set("Content-Type", contentType)
+	ctx.Resp.Header().Set("Content-Encoding", encoding)
+	http.ServeContent(ctx.Resp, ctx.Req, name, fi.ModTime(), f)
+	return true
+}
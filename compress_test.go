@@ -0,0 +1,116 @@
+package entropy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompress(t *testing.T) {
+	app := newTestApplication()
+	app.Use(Compress(CompressConfig{MinSize: 100}))
+	big := strings.Repeat("entropy ", 100)
+	app.Get("/big", "big", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, big).Header("ETag", `"v1"`)
+	})
+	app.Get("/small", "small", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, "tiny")
+	})
+	app.Get("/png", "png", "", func(ctx *Context) Result {
+		ctx.Resp.Header().Set("Content-Type", "image/png")
+		ctx.Resp.Write([]byte(big))
+		return nil
+	})
+	app.Get("/stream", "stream", "", func(ctx *Context) Result {
+		ctx.Resp.Header().Set("Content-Type", "text/event-stream")
+		ctx.Resp.Write([]byte("data: 1\n\n"))
+		ctx.Resp.ResponseWriter.(interface{ Flush() }).Flush()
+		return nil
+	})
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		"br":      func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for accept, encoding := range map[string]string{"gzip": "gzip", "gzip;q=0.5, deflate": "deflate", "gzip, deflate, br": "br", "*": "br"} {
+		req := httptest.NewRequest("GET", "/big", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Header().Get("Content-Encoding") != encoding || rec.Header().Get("Vary") != "Accept-Encoding" ||
+			rec.Header().Get("Content-Length") != "" || rec.Header().Get("ETag") != `W/"v1"` {
+			t.Fatalf("%s: unexpected headers %v", accept, rec.Header())
+		}
+		r, err := readers[encoding](rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err := ioutil.ReadAll(r); err != nil || string(b) != big {
+			t.Fatalf("%s: unexpected body %q %v", accept, b, err)
+		}
+	}
+	cases := []struct {
+		path     string
+		accept   string
+		encoding string
+		vary     string
+	}{
+		{"/big", "identity", "", "Accept-Encoding"},
+		{"/big", "gzip;q=0", "", "Accept-Encoding"},
+		{"/small", "gzip", "", "Accept-Encoding"},
+		{"/png", "gzip", "", ""},
+		{"/stream", "gzip", "gzip", "Accept-Encoding"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept-Encoding", c.accept)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Header().Get("Content-Encoding") != c.encoding || rec.Header().Get("Vary") != c.vary {
+			t.Fatalf("%s %s: unexpected headers %v", c.path, c.accept, rec.Header())
+		}
+		if c.path == "/stream" && !rec.Flushed {
+			t.Fatalf("expected the stream to be flushed")
+		}
+	}
+}
+
+func TestPrecompressedStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "entropy-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "static"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "static", "app.js"), []byte("console.log(1)"), 0644)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("console.log(1)"))
+	w.Close()
+	ioutil.WriteFile(filepath.Join(dir, "static", "app.js.gz"), gz.Bytes(), 0644)
+	app := newTestApplication()
+	app.AppPath = dir
+	app.Use(Compress(CompressConfig{MinSize: -1}))
+	for accept, encoding := range map[string]string{"gzip, br": "gzip", "": ""} {
+		req := httptest.NewRequest("GET", "/static/app.js", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Code != 200 || rec.Header().Get("Content-Encoding") != encoding || rec.Header().Get("Vary") != "Accept-Encoding" ||
+			!strings.Contains(rec.Header().Get("Content-Type"), "javascript") {
+			t.Fatalf("%q: unexpected response %d %v", accept, rec.Code, rec.Header())
+		}
+		if encoding == "gzip" && !bytes.Equal(rec.Body.Bytes(), gz.Bytes()) {
+			t.Fatalf("expected the precompressed file to be sent as is")
+		}
+	}
+}
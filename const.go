@@ -9,3 +9,13 @@ const (
 const (
 	XSRF = "_xsrf_"
 )
+
+//Setting.TrailingSlash的取值
+const (
+	//重定向到注册处理器时使用的形式
+	TrailingSlashRedirect = "redirect"
+	//有无末尾的/都能匹配
+	TrailingSlashBoth = "both"
+	//严格匹配,不做任何处理
+	TrailingSlashStrict = "strict"
+)
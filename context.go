@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -17,13 +18,23 @@ type Context struct {
 	Resp         Response
 	HandlerName  string
 	HandlerCName string
-	Flash        *Flash
-	Session      *Session
-	Data         map[string]interface{}
-	startTime    time.Time
-	RequireXsrf  bool
-	Xsrf         string
-	Form         *Form
+	//处理器的完整名字,Blueprint中的处理器为 bp.name
+	Endpoint    string
+	Flash       *Flash
+	Session     *Session
+	Data        map[string]interface{}
+	startTime   time.Time
+	RequireXsrf bool
+	Xsrf        string
+	Form        *Form
+	//处理请求时发生的错误,供错误处理器显示
+	Err error
+	//匹配到的路由
+	route *route
+	//域名和路径中的参数,键为参数的名字
+	params map[string]string
+	//请求体的最大字节数及multipart表单使用的最大内存,见limit.go
+	maxBodySize, maxMemory int64
 }
 
 type Flash struct {
@@ -69,15 +80,13 @@ func (self *Context) GetXsrf() string {
 	return self.Xsrf
 }
 
+//请求的查询字符串中是否有参数
 func (self *Context) HasQueryArgs() bool {
-	if len(self.Req.Form) == 0 {
-		return true
-	} else {
-		return false
-	}
+	return len(self.Req.URL.Query()) > 0
 }
 
 func (self *Context) GetQueryArg(name, defaultValue string) string {
+	self.parseBody()
 	if param, ok := self.Req.Form[name]; ok {
 		return param[0]
 	} else {
@@ -85,33 +94,55 @@ func (self *Context) GetQueryArg(name, defaultValue string) string {
 	}
 }
 
-//reverse
-func (self *Context) Reverse(name string, arg ...interface{}) string {
-	if strings.Contains(name, ".") {
-		_tmp := strings.Split(name, ".")
-		if spec, ok := self.App.Blueprints[_tmp[0]].NamedHandlers[_tmp[1]]; ok {
-			url, err := spec.UrlSetParams(arg...)
-			if err != nil {
-				return err.Error()
-			} else {
-				return self.App.Blueprints[_tmp[0]].Prefix + url[1:]
-			}
-		}
+//reverse,名字形如 handler 或 bp.handler,嵌套的Blueprint为 api.v1.users.show
+//处理器绑定的域名与当前请求的域名不同时,返回包含协议和域名的绝对地址
+func (self *Context) Reverse(name string, arg ...interface{}) (string, error) {
+	host, url, err := self.App.reverse(name, arg...)
+	if err != nil {
+		return "", err
 	}
-	if spec, ok := self.App.NamedHandlers[name]; ok {
-		url, err := spec.UrlSetParams(arg...)
-		if err != nil {
-			return err.Error()
-		} else {
-			return url[1:]
-		}
+	return self.absolute(host, false, url), nil
+}
+
+//与Reverse相同,生成失败时panic,由InternalServerErrorHandler处理
+func (self *Context) MustReverse(name string, arg ...interface{}) string {
+	url, err := self.Reverse(name, arg...)
+	if err != nil {
+		panic(err)
+	}
+	return url
+}
+
+//当前请求的协议,位于反向代理之后时使用X-Forwarded-Proto
+func (self *Context) Scheme() string {
+	if self.Req == nil {
+		return "http"
+	}
+	if proto := self.Req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+	if self.Req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+//当前请求的端口号,如 :8080,没有端口号时为空
+func (self *Context) port() string {
+	if self.Req == nil {
+		return ""
+	}
+	if _, port, err := net.SplitHostPort(self.Req.Host); err == nil {
+		return ":" + port
 	}
-	return fmt.Sprintf("处理器 %s 没有找到", name)
+	return ""
 }
 
 func (self *Context) generateXsrf() {
 	if self.RequireXsrf {
-		self.Xsrf = base64.StdEncoding.EncodeToString([]byte(time.Now().Format(time.RFC3339)))[22:30] + randString(8)
+		//RFC3339的长度随时区变化,取编码结果的最后8位
+		encoded := base64.StdEncoding.EncodeToString([]byte(time.Now().Format(time.RFC3339)))
+		self.Xsrf = encoded[len(encoded)-8:] + randString(8)
 		self.SetSecureCookie(self.App.Setting.XsrfCookie, self.Xsrf, 600)
 	}
 }
@@ -152,11 +183,9 @@ func (self *Context) IsPost() bool {
 	}
 }
 
+//读取上一个请求留下的flash消息,cookie在flushMessage中被覆盖
 func (self *Context) restoreMessages() {
 	_tmp, err := self.SecureCookie(self.App.Setting.FlashCookieName)
-	defer func() {
-		self.SetSecureCookie(self.App.Setting.FlashCookieName, "", -1)
-	}()
 	if err == nil {
 		if err := json.Unmarshal([]byte(_tmp), &self.Flash); err != nil {
 			log.Println("restoreMessages", err)
@@ -0,0 +1,24 @@
+package entropy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGenerateXsrfInUTC(t *testing.T) {
+	//UTC的RFC3339时间以Z结尾,base64编码后只有28个字符
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+	rec := httptest.NewRecorder()
+	ctx := &Context{
+		App:         &Application{Setting: &Setting{XsrfCookie: "xsrf"}},
+		Resp:        Response{rec},
+		RequireXsrf: true,
+	}
+	ctx.generateXsrf()
+	if len(ctx.Xsrf) != 16 || rec.Header().Get("Set-Cookie") == "" {
+		t.Fatalf("unexpected xsrf token %q", ctx.Xsrf)
+	}
+}
@@ -0,0 +1,325 @@
+package entropy
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//处理器返回的Result实现了该接口时,Result自行处理整个响应:
+//不再写入flash消息和xsrf的cookie,留给下一个页面使用
+type rawResult interface {
+	Result
+	raw()
+}
+
+//===========================File结果======================
+//发送本地文件,支持Range、If-None-Match和If-Modified-Since,适合需要经过filter检查权限的下载
+func NewFileResult(ctx *Context, path string) *FileResult {
+	return &FileResult{Context: ctx, Path: path}
+}
+
+type FileResult struct {
+	resultHeader
+	Context *Context
+	Path    string
+	//下载时使用的文件名,为空时使用文件本身的名字
+	Name string
+	//是否作为附件下载,否则浏览器直接显示文件
+	Attachment bool
+	//每秒最多发送的字节数,0表示不限制
+	Rate int64
+}
+
+//作为附件下载,name为空时使用文件本身的名字,可以包含中文
+func (self *FileResult) AsAttachment(name string) *FileResult {
+	self.Attachment = true
+	self.Name = name
+	return self
+}
+
+//限制每秒发送的字节数
+func (self *FileResult) Limit(bytesPerSecond int64) *FileResult {
+	self.Rate = bytesPerSecond
+	return self
+}
+
+func (self *FileResult) Status(code int) *FileResult {
+	self.code = code
+	return self
+}
+
+func (self *FileResult) Header(key, value string) *FileResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *FileResult) raw() {}
+
+func (self *FileResult) Execute(ctx *Context) error {
+	f, err := os.Open(self.Path)
+	if os.IsNotExist(err) {
+		panic(404)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		panic(404)
+	}
+	name := self.Name
+	if name == "" {
+		name = fi.Name()
+	}
+	self.copyHeader(ctx)
+	header := ctx.Resp.Header()
+	if header.Get("ETag") == "" {
+		header.Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()))
+	}
+	if self.Attachment {
+		header.Set("Content-Disposition", contentDisposition("attachment", name))
+	}
+	//ServeContent不返回错误,发送过程中客户端断开连接时直接结束
+	http.ServeContent(self.writer(ctx), ctx.Req, name, fi.ModTime(), f)
+	return nil
+}
+
+//===========================File结果 end======================
+
+//===========================Stream结果======================
+//发送io.Reader中的内容;Reader实现了io.ReadSeeker时支持Range,否则只支持条件请求
+func NewStreamResult(ctx *Context, reader io.Reader, name string, modTime time.Time) *StreamResult {
+	return &StreamResult{Context: ctx, Reader: reader, Name: name, ModTime: modTime}
+}
+
+type StreamResult struct {
+	resultHeader
+	Context *Context
+	Reader  io.Reader
+	//文件名,用于判断Content-Type及作为附件下载时的文件名
+	Name string
+	//最后修改时间,为零值时不处理If-Modified-Since
+	ModTime time.Time
+	//内容的ETag,包含引号,如 "v1";为空时不处理If-None-Match
+	ETag       string
+	Attachment bool
+	Rate       int64
+}
+
+func (self *StreamResult) AsAttachment() *StreamResult {
+	self.Attachment = true
+	return self
+}
+
+func (self *StreamResult) Limit(bytesPerSecond int64) *StreamResult {
+	self.Rate = bytesPerSecond
+	return self
+}
+
+func (self *StreamResult) Status(code int) *StreamResult {
+	self.code = code
+	return self
+}
+
+func (self *StreamResult) Header(key, value string) *StreamResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *StreamResult) raw() {}
+
+func (self *StreamResult) Execute(ctx *Context) error {
+	if closer, ok := self.Reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	self.copyHeader(ctx)
+	header := ctx.Resp.Header()
+	if self.ETag != "" {
+		header.Set("ETag", self.ETag)
+	}
+	if self.Attachment {
+		header.Set("Content-Disposition", contentDisposition("attachment", self.Name))
+	}
+	w := self.writer(ctx)
+	if seeker, ok := self.Reader.(io.ReadSeeker); ok {
+		http.ServeContent(w, ctx.Req, self.Name, self.ModTime, seeker)
+		return nil
+	}
+	if notModified(ctx.Req, self.ETag, self.ModTime) {
+		header.Del("Content-Type")
+		w.WriteHeader(304)
+		return nil
+	}
+	if header.Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(filepath.Ext(self.Name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+	}
+	if !self.ModTime.IsZero() {
+		header.Set("Last-Modified", self.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(200)
+	if ctx.Req.Method != "HEAD" {
+		//响应已经开始发送,出错时无法再返回错误页面,只记录日志
+		if _, err := io.Copy(w, self.Reader); err != nil {
+			log.Println("发送", self.Name, "失败:", err)
+		}
+	}
+	return nil
+}
+
+//===========================Stream结果 end======================
+
+//文件和流使用的ResponseWriter:设置了状态码时替换200,设置了速度时限制发送速度
+func (self *resultHeader) writerFor(ctx *Context, rate int64) http.ResponseWriter {
+	w := throttle(ctx.Resp.ResponseWriter, rate)
+	if self.code != 0 {
+		w = &statusWriter{ResponseWriter: w, code: self.code}
+	}
+	return w
+}
+
+func (self *FileResult) writer(ctx *Context) http.ResponseWriter {
+	return self.writerFor(ctx, self.Rate)
+}
+
+func (self *StreamResult) writer(ctx *Context) http.ResponseWriter {
+	return self.writerFor(ctx, self.Rate)
+}
+
+//将完整内容的200替换为Status设置的状态码,206和304等保持不变
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (self *statusWriter) WriteHeader(code int) {
+	if code == 200 {
+		code = self.code
+	}
+	self.ResponseWriter.WriteHeader(code)
+}
+
+//判断条件请求是否可以返回304,If-None-Match优先于If-Modified-Since
+func notModified(req *http.Request, etag string, modTime time.Time) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && !modTime.IsZero() {
+		return !modTime.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+//生成Content-Disposition头,非ASCII的文件名使用RFC 5987编码的filename*,同时提供ASCII的filename供旧的浏览器使用
+func contentDisposition(kind string, name string) string {
+	if name == "" {
+		return kind
+	}
+	fallback := make([]byte, 0, len(name))
+	encoded := make([]byte, 0, len(name))
+	ascii := true
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			ascii = false
+			if c < 0x80 || name[i]&0xc0 == 0xc0 {
+				fallback = append(fallback, '_')
+			}
+		} else {
+			fallback = append(fallback, c)
+		}
+		if isAttrChar(c) {
+			encoded = append(encoded, c)
+		} else {
+			encoded = append(encoded, fmt.Sprintf("%%%02X", c)...)
+		}
+	}
+	if ascii {
+		return fmt.Sprintf(`%s; filename="%s"`, kind, name)
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, kind, fallback, encoded)
+}
+
+//RFC 5987中可以不编码的字符
+func isAttrChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+//限制发送速度的ResponseWriter
+type throttledWriter struct {
+	http.ResponseWriter
+	rate    int64
+	start   time.Time
+	written int64
+}
+
+//rate大于0时包装ResponseWriter,限制每秒发送的字节数
+func throttle(w http.ResponseWriter, rate int64) http.ResponseWriter {
+	if rate <= 0 {
+		return w
+	}
+	return &throttledWriter{ResponseWriter: w, rate: rate}
+}
+
+func (self *throttledWriter) Write(p []byte) (int, error) {
+	if self.start.IsZero() {
+		self.start = time.Now()
+	}
+	//每次最多发送十分之一秒的数据,避免一次写入大块数据后长时间等待
+	size := int(self.rate / 10)
+	if size < 1 {
+		size = 1
+	}
+	total := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		n, err := self.ResponseWriter.Write(chunk)
+		total += n
+		self.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+		if wait := self.expected() - time.Since(self.start); wait > 0 {
+			time.Sleep(wait)
+		}
+		if flusher, ok := self.ResponseWriter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	return total, nil
+}
+
+//按照限速发送已写入的数据应当花费的时间;用浮点数计算,written * time.Second在9GB左右就会溢出
+func (self *throttledWriter) expected() time.Duration {
+	return time.Duration(float64(self.written) / float64(self.rate) * float64(time.Second))
+}
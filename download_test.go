@@ -0,0 +1,90 @@
+package entropy
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileResult(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.txt")
+	if err := ioutil.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApplication()
+	app.Get("/download", "download", "", func(ctx *Context) Result {
+		return NewFileResult(ctx, path).AsAttachment("报告 2014.txt")
+	})
+	app.Get("/missing", "missing", "", func(ctx *Context) Result {
+		return NewFileResult(ctx, filepath.Join(dir, "missing.txt"))
+	})
+
+	req := httptest.NewRequest("GET", "/download", nil)
+	req.Header.Set("Range", "bytes=2-4")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != 206 || rec.Body.String() != "234" {
+		t.Fatalf("unexpected range response %d %q", rec.Code, rec.Body.String())
+	}
+	disposition := rec.Header().Get("Content-Disposition")
+	if disposition != `attachment; filename="__ 2014.txt"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%202014.txt` {
+		t.Fatalf("unexpected Content-Disposition %q", disposition)
+	}
+	if rec.Header().Get("Set-Cookie") != "" {
+		t.Fatalf("downloads should not set cookies, got %q", rec.Header().Get("Set-Cookie"))
+	}
+
+	req = httptest.NewRequest("GET", "/download", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != 304 || rec.Body.Len() != 0 {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+	if rec.Code != 404 {
+		t.Fatalf("expected 404 for a missing file, got %d", rec.Code)
+	}
+}
+
+func TestStreamResult(t *testing.T) {
+	modTime := time.Date(2014, 5, 1, 0, 0, 0, 0, time.UTC)
+	content := strings.Repeat("x", 200)
+	app := newTestApplication()
+	app.Get("/stream", "stream", "", func(ctx *Context) Result {
+		//ioutil.NopCloser隐藏了Seek,只能按顺序发送
+		return NewStreamResult(ctx, ioutil.NopCloser(strings.NewReader(content)), "data.csv", modTime).Limit(2000)
+	})
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/stream", nil))
+	if rec.Code != 200 || rec.Body.String() != content || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("unexpected stream response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected the output to be rate limited, took %v", elapsed)
+	}
+
+	req := httptest.NewRequest("GET", "/stream", nil)
+	req.Header.Set("If-Modified-Since", modTime.Format("Mon, 02 Jan 2006 15:04:05 GMT"))
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != 304 {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+}
+
+func TestThrottleLargeFile(t *testing.T) {
+	//20GB按1MB/s发送需要20480秒,计算时不能溢出
+	w := &throttledWriter{rate: 1 << 20, written: 20 << 30}
+	if expected := w.expected(); expected != 20480*time.Second {
+		t.Fatalf("unexpected duration %v", expected)
+	}
+}
@@ -9,41 +9,80 @@ var (
 )
 
 func init() {
+	ErrHandlers[400] = BadRequestErrorHandler
 	ErrHandlers[404] = NotFoundErrorHandler
+	ErrHandlers[405] = MethodNotAllowedErrorHandler
+	ErrHandlers[406] = NotAcceptableErrorHandler
+	ErrHandlers[413] = RequestEntityTooLargeErrorHandler
 
 }
 
-//404默认处理函数
-func NotFoundErrorHandler(ctx *Context) (b bool, r Result) {
-	b = true
-	r = nil
-	ctx.Resp.WriteHeader(404)
-	t, err := template.New("NotFound").Parse(errorTpl)
+//输出错误页面;客户端接受JSON时输出RFC 7807的problem+json文档,messages作为detail
+func renderError(ctx *Context, code int, title string, messages []string) {
+	if acceptsProblem(ctx) {
+		writeProblem(ctx, problemFor(ctx, code, title, messages))
+		return
+	}
+	ctx.Resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	ctx.Resp.WriteHeader(code)
+	t, err := template.New("Error").Parse(errorTpl)
 	if err != nil {
 		panic(err)
 	}
 	d := make(map[string]interface{})
-	d["Code"] = 404
-	d["Title"] = "页面没有找到 = =#"
-	d["Messages"] = []string{"该页面可能去打酱油了，请稍候再试！", "如果这已经是第二次出现，请检查输入的链接是否正确……", "如果均已确认，请参照第一条……"}
+	d["Code"] = code
+	d["Title"] = title
+	d["Messages"] = messages
 	d["Version"] = EntropyVersion
 	t.Execute(ctx.Resp, d)
-	return
+}
+
+//400默认处理函数,错误原因保存在ctx.Err中
+func BadRequestErrorHandler(ctx *Context) (b bool, r Result) {
+	if ctx.Err != nil {
+		renderError(ctx, 400, "请求参数错误", []string{ctx.Err.Error()})
+	} else {
+		renderError(ctx, 400, "请求参数错误", []string{"请检查输入的链接或提交的内容是否正确"})
+	}
+	return true, nil
+}
+
+//404默认处理函数
+func NotFoundErrorHandler(ctx *Context) (b bool, r Result) {
+	renderError(ctx, 404, "页面没有找到 = =#", []string{"该页面可能去打酱油了，请稍候再试！", "如果这已经是第二次出现，请检查输入的链接是否正确……", "如果均已确认，请参照第一条……"})
+	return true, nil
+}
+
+//405默认处理函数,Allow头在调用之前已经设置
+func MethodNotAllowedErrorHandler(ctx *Context) (b bool, r Result) {
+	renderError(ctx, 405, "请求方法不被允许", []string{"该页面不支持 " + ctx.Req.Method + " 请求,允许的请求方法为: " + ctx.Resp.Header().Get("Allow")})
+	return true, nil
+}
+
+//406默认处理函数,可以提供的格式保存在ctx.Err中
+func NotAcceptableErrorHandler(ctx *Context) (b bool, r Result) {
+	if ctx.Err != nil {
+		renderError(ctx, 406, "无法提供请求的格式", []string{"请检查请求的Accept头", ctx.Err.Error()})
+	} else {
+		renderError(ctx, 406, "无法提供请求的格式", []string{"请检查请求的Accept头"})
+	}
+	return true, nil
+}
+
+//413默认处理函数,请求体超出了Setting.MaxBodySize或BodyLimit设置的大小
+func RequestEntityTooLargeErrorHandler(ctx *Context) (b bool, r Result) {
+	ctx.Resp.Header().Set("Connection", "close")
+	renderError(ctx, 413, "提交的内容过大", []string{"请减小上传文件或提交内容的大小后重试"})
+	return true, nil
 }
 
 //500错误默认处理函数
 func InternalServerErrorHandler(ctx *Context, code int, err error, debug bool) {
-	t, _ := template.New("Error").Parse(errorTpl)
-	d := make(map[string]interface{})
-	d["Code"] = code
-	d["Version"] = EntropyVersion
-	d["Title"] = err.Error()
 	if debug {
-		d["Messages"] = MakeStack()
+		renderError(ctx, code, err.Error(), MakeStack())
 	} else {
-		d["Messages"] = []string{"很抱歉，应用程序发生了错误！"}
+		renderError(ctx, code, err.Error(), []string{"很抱歉，应用程序发生了错误！"})
 	}
-	t.Execute(ctx.Resp, d)
 }
 
 var errorTpl = `
@@ -0,0 +1,122 @@
+package entropy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//声明当前内容的ETag和最后修改时间,并判断客户端的缓存是否仍然有效.
+//返回true时处理器可以跳过渲染,直接返回 NewStatusResult(ctx, 304);
+//etag为空或modTime为零值时不设置对应的响应头,没有加引号的etag会自动加上引号
+func (self *Context) NotModified(etag string, modTime time.Time) bool {
+	header := self.Resp.Header()
+	if etag != "" {
+		etag = quoteETag(etag)
+		header.Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		header.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	return notModified(self.Req, etag, modTime)
+}
+
+//给etag加上引号,已经是"xxx"或W/"xxx"形式的保持不变
+func quoteETag(etag string) string {
+	if strings.HasSuffix(etag, `"`) && (strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`)) {
+		return etag
+	}
+	return strconv.Quote(etag)
+}
+
+//为GET和HEAD请求的结果生成ETag的中间件,weak为true时生成弱ETag.
+//结果先渲染到内存中,根据内容计算ETag,与If-None-Match匹配时返回304;
+//只处理状态码为200且没有设置ETag的响应,文件和流自行处理条件请求,不经过这里
+func ETag(weak bool) Middleware {
+	return func(ctx *Context, next func() Result) Result {
+		result := next()
+		if result == nil || (ctx.Req.Method != "GET" && ctx.Req.Method != "HEAD") {
+			return result
+		}
+		if _, ok := result.(rawResult); ok {
+			return result
+		}
+		return &etagResult{result: result, weak: weak}
+	}
+}
+
+type etagResult struct {
+	result Result
+	weak   bool
+}
+
+func (self *etagResult) Execute(ctx *Context) error {
+	w := &bufferWriter{ResponseWriter: ctx.Resp.ResponseWriter}
+	method := ctx.Req.Method
+	//HEAD请求按GET渲染,ETag与GET请求的一致
+	ctx.Resp.ResponseWriter, ctx.Req.Method = w, "GET"
+	if err := self.render(ctx, w, method); err != nil {
+		return err
+	}
+	header := ctx.Resp.Header()
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if w.code == http.StatusOK && header.Get("ETag") == "" {
+		etag := fmt.Sprintf(`"%x"`, sha1.Sum(w.buf.Bytes()))
+		if self.weak {
+			etag = "W/" + etag
+		}
+		header.Set("ETag", etag)
+		modTime, _ := http.ParseTime(header.Get("Last-Modified"))
+		if notModified(ctx.Req, etag, modTime) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			ctx.Resp.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	if w.code != http.StatusNoContent && w.code != http.StatusNotModified {
+		header.Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	}
+	ctx.Resp.WriteHeader(w.code)
+	if method != "HEAD" {
+		ctx.Resp.Write(w.buf.Bytes())
+	}
+	return nil
+}
+
+//渲染到w中;结果panic(如406、400)时同样恢复原来的ResponseWriter和请求方法,错误页面才能输出到客户端
+func (self *etagResult) render(ctx *Context, w *bufferWriter, method string) error {
+	defer func() {
+		ctx.Resp.ResponseWriter, ctx.Req.Method = w.ResponseWriter, method
+	}()
+	return self.result.Execute(ctx)
+}
+
+//缓存状态码和内容的ResponseWriter,响应头直接写入原来的ResponseWriter
+type bufferWriter struct {
+	http.ResponseWriter
+	code int
+	buf  bytes.Buffer
+}
+
+func (self *bufferWriter) WriteHeader(code int) {
+	if self.code == 0 {
+		self.code = code
+	}
+}
+
+func (self *bufferWriter) Write(p []byte) (int, error) {
+	if self.code == 0 {
+		self.code = http.StatusOK
+	}
+	return self.buf.Write(p)
+}
+
+//内容全部缓存,Flush不做任何事
+func (self *bufferWriter) Flush() {}
@@ -0,0 +1,93 @@
+package entropy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestETagMiddleware(t *testing.T) {
+	app := newTestApplication()
+	renders := 0
+	updated := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	app.Get("/page", "page", "", func(ctx *Context) Result {
+		renders++
+		return NewTextResult(ctx, "hello")
+	}, ETag(false))
+	app.Get("/weak", "weak", "", func(ctx *Context) Result {
+		return NewJsonResult(ctx, []int{1, 2})
+	}, ETag(true))
+	app.Get("/post", "post", "", func(ctx *Context) Result {
+		if ctx.NotModified("v7", updated) {
+			return NewStatusResult(ctx, 304)
+		}
+		renders++
+		return NewTextResult(ctx, "expensive")
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/page", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != 200 || len(etag) != 42 || rec.Header().Get("Content-Length") != "5" || rec.Body.String() != "hello" {
+		t.Fatalf("unexpected response %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+	for _, method := range []string{"GET", "HEAD"} {
+		req := httptest.NewRequest(method, "/page", nil)
+		req.Header.Set("If-None-Match", `"other", `+etag)
+		rec = httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Code != 304 || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+			t.Fatalf("%s: expected 304, got %d %v", method, rec.Code, rec.Header())
+		}
+	}
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/weak", nil))
+	if etag := rec.Header().Get("ETag"); etag[:3] != `W/"` || rec.Body.String() != "[1,2]" {
+		t.Fatalf("expected a weak etag, got %v %q", rec.Header(), rec.Body.String())
+	}
+
+	renders = 0
+	cases := []struct {
+		header string
+		value  string
+		code   int
+	}{
+		{"If-None-Match", `"v7"`, 304},
+		{"If-None-Match", `W/"v7"`, 304},
+		{"If-None-Match", `"v6"`, 200},
+		{"If-Modified-Since", updated.Format(http.TimeFormat), 304},
+		{"If-Modified-Since", updated.Add(-time.Hour).Format(http.TimeFormat), 200},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/post", nil)
+		req.Header.Set(c.header, c.value)
+		rec = httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Code != c.code || rec.Header().Get("ETag") != `"v7"` || rec.Header().Get("Last-Modified") != updated.Format(http.TimeFormat) {
+			t.Fatalf("%s %s: unexpected response %d %v", c.header, c.value, rec.Code, rec.Header())
+		}
+	}
+	if renders != 2 {
+		t.Fatalf("expected 2 renders, got %d", renders)
+	}
+}
+
+func TestETagPanickingResult(t *testing.T) {
+	app := newTestApplication()
+	app.Get("/data", "data", "", func(ctx *Context) Result {
+		return ctx.Negotiate(map[string]int{"a": 1}, NegotiateOptions{Offers: []string{"application/json"}})
+	}, ETag(false))
+	app.Get("/jsonp", "jsonp", "", func(ctx *Context) Result {
+		return NewJsonpResult(ctx, ctx.Query("callback", ""), 1)
+	}, ETag(false))
+	for path, code := range map[string]int{"/data": 406, "/jsonp?callback=alert(1)": 400} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "text/html")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Code != code || rec.Body.Len() == 0 {
+			t.Fatalf("%s: expected a %d page, got %d %q", path, code, rec.Code, rec.Body.String())
+		}
+	}
+}
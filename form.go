@@ -24,9 +24,32 @@ func NewForm(fileds ...IField) *Form {
 }
 
 /*从请求中分析表单
+不经过Setting.MaxMemory和BodyLimit的限制,multipart表单使用net/http默认的32M内存;
+含有FileField或需要限制请求体时请使用Context.ParseForm
  */
 func ParseForm(rawForm *Form, r *http.Request) *Form {
+	return fillForm(rawForm, r)
+}
+
+/*从请求中分析表单,请求体的大小和multipart使用的内存遵循Setting.MaxBodySize、Setting.MaxMemory和BodyLimit,
+请求体过大时返回413;无法解析的表单与没有提交一样,由各字段的验证器处理
+ */
+func (self *Context) ParseForm(rawForm *Form) *Form {
+	self.parseBody()
+	return fillForm(rawForm, self.Req)
+}
+
+func fillForm(rawForm *Form, r *http.Request) *Form {
 	for name, field := range rawForm.fields {
+		if f, ok := field.(*FileField); ok {
+			//FormValue会先解析multipart表单
+			r.FormValue(name)
+			f.SetUpload(nil)
+			if uploads, err := requestUploads(r, name); err == nil {
+				f.SetUpload(uploads[0])
+			}
+			continue
+		}
 		field.SetValue(strings.TrimSpace(r.FormValue(name)))
 	}
 	return rawForm
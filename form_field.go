@@ -202,3 +202,48 @@ func NewHiddenField(name string, value string) *HiddenField {
 
 	return &field
 }
+
+//文件上传字段,使用时表单需要设置 enctype="multipart/form-data"
+type FileField struct {
+	BaseField
+	//上传的文件,没有上传时为nil
+	Upload         *Upload
+	fileValidators []IFileValidator
+}
+
+func (field *FileField) Render(class string, attrs []string) template.HTML {
+	attrsStr := ""
+	if len(attrs) > 0 {
+		for _, attr := range attrs {
+			attrsStr += " " + template.HTMLEscapeString(attr)
+		}
+	}
+	return template.HTML(fmt.Sprintf(`<input type="file" class="%s" name=%q id=%q%s>`, class, field.name, field.name, attrsStr))
+}
+
+func (field *FileField) Validate() (bool, string) {
+	for _, validator := range field.fileValidators {
+		if ok, message := validator.VerifyFile(field.Upload); !ok {
+			return false, field.label + message
+		}
+	}
+	return true, ""
+}
+
+//设置上传的文件,字段的值为文件名
+func (field *FileField) SetUpload(upload *Upload) {
+	field.Upload = upload
+	field.value = ""
+	if upload != nil {
+		field.value = upload.Filename
+	}
+}
+
+func NewFileField(name string, label string, validators ...IFileValidator) *FileField {
+	field := FileField{}
+	field.name = name
+	field.label = label
+	field.fileValidators = validators
+
+	return &field
+}
@@ -3,3 +3,61 @@ package entropy
 type IValidator interface {
 	Verify(value string) (bool, string)
 }
+
+//FileField使用的验证器
+type IFileValidator interface {
+	//没有上传文件时upload为nil
+	VerifyFile(upload *Upload) (bool, string)
+}
+
+//必须上传文件
+type FileRequired struct {
+}
+
+func (v FileRequired) VerifyFile(upload *Upload) (bool, string) {
+	if upload == nil {
+		return false, "必须上传文件!"
+	}
+	return true, ""
+}
+
+//文件大小不能超过Size字节
+type MaxFileSize struct {
+	Size int64
+}
+
+func (v MaxFileSize) VerifyFile(upload *Upload) (bool, string) {
+	if upload == nil {
+		return true, ""
+	}
+	if err := upload.CheckSize(v.Size); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+//允许的扩展名,如 FileExt{".jpg", ".png"}
+type FileExt []string
+
+func (v FileExt) VerifyFile(upload *Upload) (bool, string) {
+	if upload == nil {
+		return true, ""
+	}
+	if err := upload.CheckExt(v...); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+//允许的MIME类型,根据文件内容检测,如 FileType{"image/*"}
+type FileType []string
+
+func (v FileType) VerifyFile(upload *Upload) (bool, string) {
+	if upload == nil {
+		return true, ""
+	}
+	if err := upload.CheckType(v...); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
@@ -1,6 +1,193 @@
 package entropy
 
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+//处理器必须是函数,第一个参数为*Context,其余参数依次对应路径中的参数,返回一个Result;
+//结构体(或结构体指针)参数不对应路径参数,调用处理器前通过Context.Bind自动绑定
 type Handler interface{}
 
-//如果返回的布尔值为True,则继续运行,否则跳出,执行Result
+//如果返回的布尔值为True,则继续运行,否则跳出,执行Result.
+//Filter通过BeforeMiddleware/AfterMiddleware包装为中间件执行
 type Filter func(*Context) (bool, Result)
+
+var (
+	contextType         = reflect.TypeOf((*Context)(nil))
+	resultType          = reflect.TypeOf((*Result)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+//将路径中的一个参数转换为处理器需要的类型
+type paramDecoder func(value string) (reflect.Value, error)
+
+//处理器的调用计划,在注册时根据处理器的签名生成,避免每次请求都重复反射
+type handlerPlan struct {
+	fn       reflect.Value
+	decoders []paramDecoder
+	//需要自动绑定的结构体参数,键为参数的位置(不含ctx)
+	binds map[int]reflect.Type
+}
+
+//检查处理器的签名并生成调用计划
+func newHandlerPlan(spec *URLSpec) (*handlerPlan, error) {
+	handler := reflect.TypeOf(spec.Handler)
+	if handler == nil || handler.Kind() != reflect.Func {
+		return nil, fmt.Errorf("处理器 %s (%s) 必须是一个函数, 而不是 %T", spec.Name, spec.Pattern, spec.Handler)
+	}
+	if handler.IsVariadic() {
+		return nil, fmt.Errorf("处理器 %s (%s) 不能使用可变参数", spec.Name, spec.Pattern)
+	}
+	if handler.NumIn() == 0 || handler.In(0) != contextType {
+		return nil, fmt.Errorf("处理器 %s (%s) 的第一个参数必须是 *entropy.Context", spec.Name, spec.Pattern)
+	}
+	if handler.NumOut() != 1 || !handler.Out(0).Implements(resultType) {
+		return nil, fmt.Errorf("处理器 %s (%s) 必须只返回一个 entropy.Result", spec.Name, spec.Pattern)
+	}
+	plan := &handlerPlan{fn: reflect.ValueOf(spec.Handler), binds: make(map[int]reflect.Type)}
+	for i := 1; i < handler.NumIn(); i++ {
+		if isBindable(handler.In(i)) {
+			plan.binds[i-1] = handler.In(i)
+			continue
+		}
+		decoder, err := newParamDecoder(handler.In(i))
+		if err != nil {
+			return nil, fmt.Errorf("处理器 %s (%s) 的第 %d 个参数: %v", spec.Name, spec.Pattern, i, err)
+		}
+		plan.decoders = append(plan.decoders, decoder)
+	}
+	//Blueprint绑定域名时,域名中的参数位于路径参数之前,所以这里只检查参数不能少于路径中的参数,
+	//参数个数是否完全一致在编译路由表时检查
+	if len(plan.decoders) < len(spec.ParamNames) {
+		return nil, fmt.Errorf("处理器 %s (%s) 需要 %d 个路径参数, 但是路径中有 %d 个参数 %v",
+			spec.Name, spec.Pattern, len(plan.decoders), len(spec.ParamNames), spec.ParamNames)
+	}
+	return plan, nil
+}
+
+//将路径中的参数转换为调用处理器时需要的参数,转换失败时返回出错参数的序号
+func (self *handlerPlan) decode(params []string) ([]reflect.Value, int, error) {
+	args := make([]reflect.Value, len(self.decoders))
+	for i, decoder := range self.decoders {
+		v, err := decoder(params[i])
+		if err != nil {
+			return nil, i, err
+		}
+		args[i] = v
+	}
+	return args, -1, nil
+}
+
+//调用处理器,第一个参数为ctx;结构体参数在这里绑定,绑定失败时返回400
+func (self *handlerPlan) call(ctx *Context, args []reflect.Value) Result {
+	in := make([]reflect.Value, 0, len(args)+len(self.binds)+1)
+	in = append(in, reflect.ValueOf(ctx))
+	total := len(args) + len(self.binds)
+	for i := 0; i < total; i++ {
+		t, ok := self.binds[i]
+		if !ok {
+			in = append(in, args[0])
+			args = args[1:]
+			continue
+		}
+		dst := reflect.New(indirectType(t))
+		if err := ctx.Bind(dst.Interface()); err != nil {
+			ctx.Err = err
+			panic(400)
+		}
+		if t.Kind() == reflect.Ptr {
+			in = append(in, dst)
+		} else {
+			in = append(in, dst.Elem())
+		}
+	}
+	out := self.fn.Call(in)[0]
+	//返回值是指针或接口时可能为nil
+	if (out.Kind() == reflect.Ptr || out.Kind() == reflect.Interface) && out.IsNil() {
+		return nil
+	}
+	return out.Interface().(Result)
+}
+
+//生成对应类型的转换函数,支持所有基本类型及实现了encoding.TextUnmarshaler的类型
+func newParamDecoder(t reflect.Type) (paramDecoder, error) {
+	if t.Kind() == reflect.Ptr && t.Implements(textUnmarshalerType) {
+		return func(value string) (reflect.Value, error) {
+			v := reflect.New(t.Elem())
+			err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+			return v, err
+		}, nil
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return func(value string) (reflect.Value, error) {
+			v := reflect.New(t)
+			err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+			return v.Elem(), err
+		}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return func(value string) (reflect.Value, error) {
+			v := reflect.New(t).Elem()
+			v.SetString(value)
+			return v, nil
+		}, nil
+	case reflect.Bool:
+		return func(value string) (reflect.Value, error) {
+			v := reflect.New(t).Elem()
+			b, err := strconv.ParseBool(value)
+			v.SetBool(b)
+			return v, err
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(value string) (reflect.Value, error) {
+			v := reflect.New(t).Elem()
+			i, err := strconv.ParseInt(value, 10, t.Bits())
+			v.SetInt(i)
+			return v, err
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(value string) (reflect.Value, error) {
+			v := reflect.New(t).Elem()
+			i, err := strconv.ParseUint(value, 10, t.Bits())
+			v.SetUint(i)
+			return v, err
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		return func(value string) (reflect.Value, error) {
+			v := reflect.New(t).Elem()
+			f, err := strconv.ParseFloat(value, t.Bits())
+			v.SetFloat(f)
+			return v, err
+		}, nil
+	}
+	return nil, fmt.Errorf("不支持的参数类型 %s", t)
+}
+
+//将路径中的参数转换为处理器需要的类型
+func convertParam(value string, t reflect.Type) (reflect.Value, error) {
+	decoder, err := newParamDecoder(t)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return decoder(value)
+}
+
+//结构体及结构体指针参数通过Bind绑定,实现了encoding.TextUnmarshaler的类型(如time.Time)除外
+func isBindable(t reflect.Type) bool {
+	if t.Implements(textUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return false
+	}
+	return t.Kind() == reflect.Struct || (t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct)
+}
+
+//去掉指针后的类型
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
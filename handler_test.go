@@ -0,0 +1,71 @@
+package entropy
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestConvertParam(t *testing.T) {
+	type level uint8
+	cases := []struct {
+		value string
+		typ   interface{}
+		want  interface{}
+	}{
+		{"42", int(0), int(42)},
+		{"-7", int64(0), int64(-7)},
+		{"200", level(0), level(200)},
+		{"true", false, true},
+		{"2.5", float32(0), float32(2.5)},
+		{"abc", "", "abc"},
+		{"127.0.0.1", net.IP{}, net.ParseIP("127.0.0.1")},
+	}
+	for _, c := range cases {
+		v, err := convertParam(c.value, reflect.TypeOf(c.typ))
+		if err != nil {
+			t.Fatalf("%s: %v", c.value, err)
+		}
+		if !reflect.DeepEqual(v.Interface(), c.want) {
+			t.Fatalf("%s: expected %v, got %v", c.value, c.want, v.Interface())
+		}
+	}
+	for _, c := range []struct {
+		value string
+		typ   interface{}
+	}{{"abc", int(0)}, {"300", level(0)}, {"yes?", false}, {"x", []string{}}} {
+		if _, err := convertParam(c.value, reflect.TypeOf(c.typ)); err == nil {
+			t.Fatalf("%s: expected an error converting to %T", c.value, c.typ)
+		}
+	}
+}
+
+func TestHandlerPlanValidation(t *testing.T) {
+	bad := []interface{}{
+		"not a function",
+		func() Result { return nil },
+		func(ctx *Context, id int) {},
+		func(ctx *Context, id []string) Result { return nil },
+		func(ctx *Context) Result { return nil },
+	}
+	for _, handler := range bad {
+		spec := NewURLSpec("/item/int:id", handler, "item", "")
+		if _, err := newHandlerPlan(spec); err == nil {
+			t.Fatalf("expected %T to be rejected", handler)
+		} else {
+			t.Log(err)
+		}
+	}
+	spec := NewURLSpec("/item/int:id", func(ctx *Context, id uint) *TextResult { return nil }, "item", "")
+	plan, err := newHandlerPlan(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, index, err := plan.decode([]string{"-1"}); err == nil || index != 0 {
+		t.Fatalf("expected decode error for parameter 0, got %d %v", index, err)
+	}
+	args, _, err := plan.decode([]string{"7"})
+	if err != nil || plan.call(&Context{}, args) != nil {
+		t.Fatalf("unexpected result %v", err)
+	}
+}
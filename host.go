@@ -0,0 +1,94 @@
+package entropy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+//匹配域名中的参数: {tenant} 或 {tenant:[a-z]+}
+var hostParamRegexp = regexp.MustCompile(`^\{(\w+)(?::(.+))?\}$`)
+
+//生成地址时域名参数只能包含字母、数字、-和_,防止通过/、?、#、@等字符改变链接指向的域名
+var hostLabelRegexp = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+
+//Blueprint绑定的域名,如 {tenant}.example.com,参数默认匹配一级域名
+type hostPattern struct {
+	Pattern string
+	regex   *regexp.Regexp
+	//参数对应的分组序号,参数正则内部的分组不计入
+	groups []int
+	//参数的名字,按出现的顺序排列
+	Names []string
+	//每个参数匹配的正则,生成地址时检查参数的值
+	labels []*regexp.Regexp
+}
+
+func newHostPattern(pattern string) *hostPattern {
+	host := &hostPattern{Pattern: strings.ToLower(pattern)}
+	labels := strings.Split(host.Pattern, ".")
+	exps := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if m := hostParamRegexp.FindStringSubmatch(label); m != nil {
+			exp := m[2]
+			if exp == "" {
+				exp = `[^.]+`
+			}
+			exps = append(exps, "(?P<"+m[1]+">"+exp+")")
+			host.Names = append(host.Names, m[1])
+			host.labels = append(host.labels, regexp.MustCompile("^(?:"+exp+")$"))
+		} else {
+			exps = append(exps, regexp.QuoteMeta(label))
+		}
+	}
+	host.regex = regexp.MustCompile(`^` + strings.Join(exps, `\.`) + `$`)
+	host.groups, _ = captureGroups(host.regex)
+	return host
+}
+
+//判断请求的域名是否匹配,返回域名中的参数;请求中的端口号不参与匹配
+func (self *hostPattern) match(host string) ([]string, bool) {
+	host = strings.ToLower(stripPort(host))
+	values := self.regex.FindStringSubmatch(host)
+	if values == nil {
+		return nil, false
+	}
+	params := make([]string, 0, len(self.groups))
+	for _, i := range self.groups {
+		params = append(params, values[i])
+	}
+	return params, true
+}
+
+//用参数替换域名中的变量,参数不足或参数的值不是合法的域名标签时返回错误
+func (self *hostPattern) fill(args []interface{}) (string, error) {
+	if len(args) < len(self.Names) {
+		return "", errors.New(fmt.Sprintf("域名 %s 需要 %d 个参数, 但是提供了 %d 个参数", self.Pattern, len(self.Names), len(args)))
+	}
+	labels := strings.Split(self.Pattern, ".")
+	index := 0
+	for i, label := range labels {
+		if hostParamRegexp.MatchString(label) {
+			value, err := formatParam(args[index])
+			if err != nil {
+				return "", err
+			}
+			value = strings.ToLower(value)
+			if !hostLabelRegexp.MatchString(value) || !self.labels[index].MatchString(value) {
+				return "", errors.New(fmt.Sprintf("域名 %s 的参数 %s 的值 %q 不是合法的域名标签", self.Pattern, self.Names[index], value))
+			}
+			labels[i] = value
+			index++
+		}
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,67 @@
+package entropy
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostBlueprint(t *testing.T) {
+	app := newTestApplication()
+	tenant := NewBlueprint("/")
+	tenant.Host = "{tenant}.example.com"
+	tenant.Get("/users/int:id", "user", "", func(ctx *Context, tenant string, id int) Result {
+		return NewTextResult(ctx, tenant+":"+ctx.MustReverse("admin.home"))
+	})
+	admin := NewBlueprint("/")
+	admin.Host = "admin.example.com"
+	admin.Get("/", "home", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, ctx.MustReverse("tenant.user", "acme", 7))
+	})
+	app.Blueprint("tenant", tenant)
+	app.Blueprint("admin", admin)
+	app.Get("/", "index", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, "index")
+	})
+	if err := app.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"http://acme.example.com:8080/users/7": "acme:http://admin.example.com:8080/",
+		"http://admin.example.com/":            "http://acme.example.com/users/7",
+		"http://www.example.org/":              "index",
+	}
+	for url, expected := range cases {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Body.String() != expected {
+			t.Fatalf("%s: expected %q, got %q", url, expected, rec.Body.String())
+		}
+	}
+}
+
+func TestHostHandlerArgs(t *testing.T) {
+	app := newTestApplication()
+	bp := NewBlueprint("/")
+	bp.Host = "{tenant}.example.com"
+	bp.Get("/users/int:id", "user", "", func(ctx *Context, id int) Result { return nil })
+	app.Blueprint("tenant", bp)
+	if err := app.Compile(); err == nil {
+		t.Fatal("expected an error for a handler without the host parameter")
+	}
+}
+
+func TestHostGroupedParam(t *testing.T) {
+	app := newTestApplication()
+	bp := NewBlueprint("/")
+	bp.Host = "{tenant:(acme|globex)}.example.com"
+	bp.Get("/items/:id", "item", "", func(ctx *Context, tenant string, id string) Result {
+		return NewTextResult(ctx, tenant+":"+id+":"+ctx.Param("id"))
+	})
+	app.Blueprint("tenant", bp)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "http://acme.example.com/items/42", nil))
+	if rec.Body.String() != "acme:42:42" {
+		t.Fatalf("unexpected response %q", rec.Body.String())
+	}
+}
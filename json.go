@@ -0,0 +1,177 @@
+package entropy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	//JsonResult和Problem使用的Content-Type,不依赖系统的mime表
+	jsonContentType    = "application/json; charset=utf-8"
+	problemContentType = "application/problem+json"
+	//流式输出时每编码多少个元素刷新一次
+	jsonFlushEvery = 256
+)
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+//ctx没有关联Application时使用默认设置
+func jsonSetting(ctx *Context) *Setting {
+	if ctx != nil && ctx.App != nil && ctx.App.Setting != nil {
+		return ctx.App.Setting
+	}
+	return &Setting{}
+}
+
+//按照Setting生成json编码器:Debug模式下使用JsonIndent缩进,JsonUnescapeHTML为true时不转义<>&
+func newJsonEncoder(ctx *Context, buf *bytes.Buffer, prefix string) *json.Encoder {
+	setting := jsonSetting(ctx)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(!setting.JsonUnescapeHTML)
+	if setting.Debug && setting.JsonIndent != "" {
+		enc.SetIndent(prefix, setting.JsonIndent)
+	}
+	return enc
+}
+
+//编码一个值,去掉Encoder在末尾添加的换行
+func encodeJson(ctx *Context, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := newJsonEncoder(ctx, &buf, "").Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+//元素个数不少于Setting.JsonStreamThreshold的切片和数组逐个元素编码输出;
+//[]byte以及自定义了MarshalJSON的类型按照原来的方式整体编码
+func streamable(ctx *Context, v interface{}) (reflect.Value, bool) {
+	threshold := jsonSetting(ctx).JsonStreamThreshold
+	if threshold <= 0 || v == nil {
+		return reflect.Value{}, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().Implements(jsonMarshalerType) {
+		return reflect.Value{}, false
+	}
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return reflect.Value{}, false
+		}
+	case reflect.Array:
+	default:
+		return reflect.Value{}, false
+	}
+	if rv.Type().Elem().Kind() == reflect.Uint8 || rv.Len() < threshold {
+		return reflect.Value{}, false
+	}
+	return rv, true
+}
+
+//JsonResult和JsonpResult编码失败时返回500的problem+json,Debug模式下detail中包含错误原因
+func jsonFailure(ctx *Context, err error) error {
+	log.Println("json编码失败:", err)
+	p := NewProblem(500, "响应内容无法编码为json")
+	if jsonSetting(ctx).Debug {
+		p.Detail = err.Error()
+	}
+	return NewProblemResult(ctx, p).Execute(ctx)
+}
+
+//===========================Problem======================
+//RFC 7807 问题详情,可以直接panic一个*Problem,由框架输出为application/problem+json
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	//表单或参数绑定的错误,键为字段名
+	Errors map[string][]string `json:"errors,omitempty"`
+}
+
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+func (self *Problem) Error() string {
+	if self.Detail != "" {
+		return self.Title + ": " + self.Detail
+	}
+	return self.Title
+}
+
+//根据错误页面的内容生成Problem,ctx.Err为BindErrors时附带各字段的错误
+func problemFor(ctx *Context, code int, title string, messages []string) *Problem {
+	p := &Problem{Type: "about:blank", Title: title, Status: code, Detail: strings.Join(messages, "\n")}
+	if ctx.Req != nil {
+		p.Instance = ctx.Req.URL.Path
+	}
+	if errs, ok := ctx.Err.(BindErrors); ok {
+		p.Errors = errs
+	}
+	return p
+}
+
+//Accept头中明确接受json且不优先html时,错误以problem+json输出;没有Accept头或*/*时仍然输出html页面
+func acceptsProblem(ctx *Context) bool {
+	if ctx.Req == nil {
+		return false
+	}
+	accept := ctx.Req.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return false
+	}
+	offer := negotiate(accept, []string{"text/html", problemContentType, "application/json"})
+	return offer != "" && offer != "text/html"
+}
+
+//输出一个Problem,错误处理器中使用,编码失败时只记录日志
+func writeProblem(ctx *Context, p *Problem) {
+	if err := NewProblemResult(ctx, p).Execute(ctx); err != nil {
+		log.Println("输出problem+json失败:", err)
+	}
+}
+
+//===========================Problem结果======================
+func NewProblemResult(ctx *Context, p *Problem) *ProblemResult {
+	return &ProblemResult{Context: ctx, Problem: p}
+}
+
+type ProblemResult struct {
+	resultHeader
+	Context *Context
+	Problem *Problem
+}
+
+//默认使用Problem.Status
+func (self *ProblemResult) Status(code int) *ProblemResult {
+	self.code = code
+	self.Problem.Status = code
+	return self
+}
+
+func (self *ProblemResult) Header(key, value string) *ProblemResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *ProblemResult) Execute(ctx *Context) error {
+	status := self.Problem.Status
+	if status == 0 {
+		status = 500
+	}
+	b, err := encodeJson(ctx, self.Problem)
+	if err != nil {
+		return err
+	}
+	ctx.Resp.Header().Set("Content-Type", problemContentType)
+	return self.write(ctx, status, b)
+}
+
+//===========================Problem结果 end======================
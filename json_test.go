@@ -0,0 +1,94 @@
+package entropy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJsonResultSettings(t *testing.T) {
+	app := newTestApplication()
+	app.Get("/html", "html", "", func(ctx *Context) Result {
+		return NewJsonResult(ctx, map[string]string{"tag": "<b>"})
+	})
+	app.Get("/list", "list", "", func(ctx *Context) Result {
+		return NewJsonResult(ctx, []int{1, 2, 3})
+	})
+	app.Get("/broken", "broken", "", func(ctx *Context) Result {
+		return NewJsonResult(ctx, []interface{}{1, make(chan int)})
+	})
+	cases := []struct {
+		setting Setting
+		path    string
+		body    string
+	}{
+		{Setting{}, "/html", `{"tag":"\u003cb\u003e"}`},
+		{Setting{JsonUnescapeHTML: true}, "/html", `{"tag":"<b>"}`},
+		{Setting{Debug: true, JsonIndent: "  "}, "/html", "{\n  \"tag\": \"\\u003cb\\u003e\"\n}"},
+		{Setting{}, "/list", `[1,2,3]`},
+		{Setting{JsonStreamThreshold: 2}, "/list", `[1,2,3]`},
+		{Setting{JsonStreamThreshold: 2, Debug: true, JsonIndent: "  "}, "/list", "[\n  1,\n  2,\n  3\n]"},
+	}
+	for _, c := range cases {
+		setting := c.setting
+		setting.StaticDir = "static"
+		app.Setting = &setting
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", c.path, nil))
+		if rec.Code != 200 || rec.Header().Get("Content-Type") != "application/json; charset=utf-8" || rec.Body.String() != c.body {
+			t.Fatalf("%+v %s: unexpected response %d %q %q", c.setting, c.path, rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+	}
+	for _, threshold := range []int{0, 1} {
+		app.Setting = &Setting{StaticDir: "static", JsonStreamThreshold: threshold}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "/broken", nil))
+		if threshold == 0 && (rec.Code != 500 || rec.Header().Get("Content-Type") != "application/problem+json") {
+			t.Fatalf("expected a problem document, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		//流式输出时第二个元素出错,响应已经开始发送
+		if threshold == 1 && (rec.Code != 200 || rec.Body.String() != "[1") {
+			t.Fatalf("expected a truncated stream, got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestProblemErrors(t *testing.T) {
+	app := newTestApplication()
+	app.Get("/bind", "bind", "", func(ctx *Context) Result {
+		ctx.Err = BindErrors{"age": {"必须是整数"}}
+		panic(400)
+	})
+	app.Get("/fail", "fail", "", func(ctx *Context) Result {
+		panic(errors.New("boom"))
+	})
+	app.Get("/teapot", "teapot", "", func(ctx *Context) Result {
+		panic(&Problem{Title: "I'm a teapot", Status: 418, Detail: "short and stout"})
+	})
+	for _, path := range []string{"/bind", "/fail", "/teapot", "/missing"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		var p Problem
+		if rec.Header().Get("Content-Type") != "application/problem+json" || json.Unmarshal(rec.Body.Bytes(), &p) != nil || p.Status != rec.Code {
+			t.Fatalf("%s: expected a problem document, got %d %q %q", path, rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+		if path == "/bind" && (p.Errors["age"][0] != "必须是整数" || p.Instance != "/bind") {
+			t.Fatalf("unexpected problem %+v", p)
+		}
+		if path == "/teapot" && (rec.Code != 418 || p.Detail != "short and stout") {
+			t.Fatalf("unexpected problem %+v", p)
+		}
+	}
+	//浏览器的Accept头仍然得到html页面
+	req := httptest.NewRequest("GET", "/fail", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != 500 || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected an html page, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
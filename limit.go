@@ -0,0 +1,70 @@
+package entropy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+//Setting中没有设置时multipart表单在内存中保存的最大字节数,超出的部分写入临时文件
+const defaultMaxMemory = 1 << 25 // 32M
+
+//限制请求体大小的Reader,在第一次读取时才确定限制,因此中间件可以在处理器读取请求体之前修改限制
+type limitedBody struct {
+	ctx    *Context
+	body   io.ReadCloser
+	reader io.ReadCloser
+}
+
+func (self *limitedBody) Read(p []byte) (int, error) {
+	if self.reader == nil {
+		limit := self.ctx.maxBodySize
+		if limit <= 0 {
+			self.reader = self.body
+		} else if self.ctx.Req.ContentLength > limit {
+			//Content-Length已经超出限制,不必读取请求体
+			return 0, &http.MaxBytesError{Limit: limit}
+		} else {
+			self.reader = http.MaxBytesReader(self.ctx.Resp.ResponseWriter, self.body, limit)
+		}
+	}
+	return self.reader.Read(p)
+}
+
+func (self *limitedBody) Close() error {
+	return self.body.Close()
+}
+
+//请求体超出大小限制时的错误
+func isBodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+//按Setting中的限制包装请求体,请求结束后删除multipart表单的临时文件
+func (self *Context) limitBody(setting *Setting) func() {
+	self.maxBodySize = setting.MaxBodySize
+	self.maxMemory = setting.MaxMemory
+	if self.Req.Body != nil && self.Req.Body != http.NoBody {
+		self.Req.Body = &limitedBody{ctx: self, body: self.Req.Body}
+	}
+	return func() {
+		if self.Req.MultipartForm != nil {
+			self.Req.MultipartForm.RemoveAll()
+		}
+	}
+}
+
+//为处理器或Blueprint单独设置请求体的最大字节数和multipart表单使用的最大内存,覆盖Setting中的设置;
+//0表示使用Setting中的设置,maxBodySize为负数表示不限制
+func BodyLimit(maxBodySize int64, maxMemory int64) Middleware {
+	return func(ctx *Context, next func() Result) Result {
+		if maxBodySize != 0 {
+			ctx.maxBodySize = maxBodySize
+		}
+		if maxMemory > 0 {
+			ctx.maxMemory = maxMemory
+		}
+		return next()
+	}
+}
@@ -0,0 +1,72 @@
+package entropy
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	app := newTestApplication()
+	app.Setting.MaxBodySize = 16
+	app.Post("/small", "small", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, ctx.FormString("name", ""))
+	})
+	app.Post("/large", "large", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, ctx.FormString("name", ""))
+	}, BodyLimit(1024, 0))
+	app.Get("/lazy", "lazy", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, "lazy")
+	})
+	body := "name=" + strings.Repeat("x", 32)
+	for path, code := range map[string]int{"/small": 413, "/large": 200} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		app.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Fatalf("%s: expected %d, got %d", path, code, rec.Code)
+		}
+	}
+	//处理器没有读取请求体时不会返回413
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/lazy", strings.NewReader(body)))
+	if rec.Code != 200 {
+		t.Fatalf("expected the body to be ignored, got %d", rec.Code)
+	}
+}
+
+func TestMultipartTempFilesRemoved(t *testing.T) {
+	app := newTestApplication()
+	app.Setting.MaxMemory = 1
+	var tmp string
+	app.Post("/upload", "upload", "", func(ctx *Context) Result {
+		ctx.FormString("name", "")
+		f, err := ctx.Req.MultipartForm.File["file"][0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if file, ok := f.(*os.File); ok {
+			tmp = file.Name()
+		}
+		return NewTextResult(ctx, "ok")
+	})
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, _ := w.CreateFormFile("file", "a.txt")
+	part.Write(bytes.Repeat([]byte("a"), 4096))
+	w.Close()
+	req := httptest.NewRequest("POST", "/upload", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	app.ServeHTTP(httptest.NewRecorder(), req)
+	if tmp == "" {
+		t.Fatal("expected the upload to be written to a temporary file")
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", tmp, err)
+	}
+}
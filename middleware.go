@@ -0,0 +1,148 @@
+package entropy
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+//中间件,调用next()继续执行后续的中间件和处理器并得到其结果;
+//不调用next()即可中断请求,也可以在next()前后计时、修改或替换结果.
+//
+//一个请求的执行顺序如下,同一级别中按注册顺序执行:
+//	1. application级别的before filter
+//	2. application级别的中间件(Application.Around)
+//	3. Blueprint级别的before filter
+//	4. Blueprint级别的中间件(Blueprint.Around),嵌套的Blueprint由外向内重复3、4两步
+//	5. 注册处理器时传入的中间件
+//	6. 处理器
+//	7. 以相反的顺序执行各中间件next()之后的部分,Blueprint的after filter在application的中间件返回之前执行,
+//	   application的after filter最后执行
+//before filter返回false时,其内层的步骤都不再执行,但外层的after filter仍会执行
+type Middleware func(ctx *Context, next func() Result) Result
+
+//将before filter包装为中间件:返回false时中断请求,输出filter返回的Result
+func BeforeMiddleware(filter Filter) Middleware {
+	return func(ctx *Context, next func() Result) Result {
+		if ok, r := filter(ctx); !ok {
+			return r
+		}
+		return next()
+	}
+}
+
+//将after filter包装为中间件:在处理器之后执行,返回false时用filter返回的Result替换处理器的结果
+func AfterMiddleware(filter Filter) Middleware {
+	return func(ctx *Context, next func() Result) Result {
+		result := next()
+		if ok, r := filter(ctx); !ok {
+			return r
+		}
+		return result
+	}
+}
+
+//包装filter,处理器的名字位于except中时跳过该filter.
+//application级别使用完整名字(Context.Endpoint)比较,Blueprint级别使用处理器自身的名字比较
+func exceptFilter(filter Filter, except []string, endpoint bool) Filter {
+	if len(except) == 0 {
+		return filter
+	}
+	return func(ctx *Context) (bool, Result) {
+		if isExcepted(ctx, except, endpoint) {
+			return true, nil
+		}
+		return filter(ctx)
+	}
+}
+
+//包装中间件,处理器的名字位于except中时直接执行next()
+func exceptMiddleware(middleware Middleware, except []string, endpoint bool) Middleware {
+	if len(except) == 0 {
+		return middleware
+	}
+	return func(ctx *Context, next func() Result) Result {
+		if isExcepted(ctx, except, endpoint) {
+			return next()
+		}
+		return middleware(ctx, next)
+	}
+}
+
+func isExcepted(ctx *Context, except []string, endpoint bool) bool {
+	name := ctx.HandlerName
+	if endpoint {
+		name = ctx.Endpoint
+	}
+	for _, e := range except {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+//将一组filter和中间件排列为中间件链,执行顺序为:before filter,中间件,处理器,中间件的后半部分,after filter.
+//after filter位于链的最外层(倒序,保证先注册的先执行),所以即使请求被中断也会执行
+func filterChain(befores []Filter, middlewares []Middleware, afters []Filter) []Middleware {
+	chain := make([]Middleware, 0, len(befores)+len(middlewares)+len(afters))
+	for i := len(afters) - 1; i >= 0; i-- {
+		chain = append(chain, AfterMiddleware(afters[i]))
+	}
+	for _, before := range befores {
+		chain = append(chain, BeforeMiddleware(before))
+	}
+	return append(chain, middlewares...)
+}
+
+//依次执行中间件,最后执行handler
+func runMiddlewares(ctx *Context, chain []Middleware, handler func() Result) Result {
+	var next func(i int) Result
+	next = func(i int) Result {
+		if i == len(chain) {
+			return handler()
+		}
+		return chain[i](ctx, func() Result {
+			return next(i + 1)
+		})
+	}
+	return next(0)
+}
+
+//filter或中间件的名字,用于Routes;except不为空时附加在名字后面
+func funcName(f interface{}, except []string) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	if len(except) > 0 {
+		name += " (except " + strings.Join(except, ", ") + ")"
+	}
+	return name
+}
+
+//按执行顺序描述一组filter和中间件;names是注册时记录的名字,直接修改了filter列表时使用函数本身的名字
+func describeFilters(kind string, funcs []interface{}, names []string) []string {
+	list := make([]string, 0, len(funcs))
+	for i, f := range funcs {
+		if len(names) == len(funcs) {
+			list = append(list, kind+" "+names[i])
+		} else {
+			list = append(list, kind+" "+funcName(f, nil))
+		}
+	}
+	return list
+}
+
+func filtersOf(filters []Filter) []interface{} {
+	list := make([]interface{}, 0, len(filters))
+	for _, f := range filters {
+		list = append(list, f)
+	}
+	return list
+}
+
+func middlewaresOf(middlewares []Middleware) []interface{} {
+	list := make([]interface{}, 0, len(middlewares))
+	for _, m := range middlewares {
+		list = append(list, m)
+	}
+	return list
+}
@@ -0,0 +1,132 @@
+package entropy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBeforeFilterShortCircuits(t *testing.T) {
+	app := newTestApplication()
+	called := false
+	app.Get("/secret", "secret", "", func(ctx *Context) Result {
+		called = true
+		return NewTextResult(ctx, "secret")
+	})
+	app.Before(func(ctx *Context) (bool, Result) {
+		return false, NewTextResult(ctx, "denied")
+	})
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/secret", nil))
+	if called {
+		t.Fatal("handler should not run when a before filter returns false")
+	}
+	if rec.Body.String() != "denied" {
+		t.Fatalf("expected filter result, got %q", rec.Body.String())
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	trace := make([]string, 0)
+	mark := func(name string) Filter {
+		return func(ctx *Context) (bool, Result) {
+			trace = append(trace, name)
+			return true, nil
+		}
+	}
+	around := func(ctx *Context, next func() Result) Result {
+		trace = append(trace, "around:in")
+		r := next()
+		trace = append(trace, "around:out")
+		return r
+	}
+	chain := filterChain([]Filter{mark("before1"), mark("before2")}, []Middleware{around}, []Filter{mark("after1"), mark("after2")})
+	runMiddlewares(&Context{}, chain, func() Result {
+		trace = append(trace, "handler")
+		return nil
+	})
+	expected := "before1,before2,around:in,handler,around:out,after1,after2"
+	if strings.Join(trace, ",") != expected {
+		t.Fatalf("expected %s, got %s", expected, strings.Join(trace, ","))
+	}
+}
+
+func TestFilterExceptAndRouteMiddleware(t *testing.T) {
+	app := newTestApplication()
+	deny := func(ctx *Context) (bool, Result) {
+		return false, NewTextResult(ctx, "denied")
+	}
+	app.Before(deny, "login", "admin.login")
+	app.Get("/login", "login", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, "login")
+	}, func(ctx *Context, next func() Result) Result {
+		next()
+		return NewTextResult(ctx, "wrapped")
+	})
+	app.Get("/home", "home", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, "home")
+	})
+	bp := NewBlueprint("/admin")
+	bp.Get("/login", "login", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, "admin login")
+	})
+	app.Blueprint("admin", bp)
+	for path, expected := range map[string]string{"/login": "wrapped", "/home": "denied", "/admin/login": "admin login"} {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Body.String() != expected {
+			t.Fatalf("%s: expected %q, got %q", path, expected, rec.Body.String())
+		}
+	}
+}
+
+func TestHttpMiddlewareAndMount(t *testing.T) {
+	app := newTestApplication()
+	app.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("X-Wrapped", "yes")
+			next.ServeHTTP(rw, req)
+		})
+	})
+	echo := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/boom" {
+			panic("boom")
+		}
+		rw.Write([]byte(req.URL.Path))
+	})
+	app.Mount("/debug", echo)
+	bp := NewBlueprint("/api")
+	bp.Mount("/legacy/", echo)
+	app.Blueprint("api", bp)
+
+	root := newTestApplication()
+	root.Mount("/", echo)
+	for path, expected := range map[string]string{"/": "/", "/files/a.txt": "/files/a.txt"} {
+		rec := httptest.NewRecorder()
+		root.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != 200 || rec.Body.String() != expected {
+			t.Fatalf("root mount %s: expected %q, got %d %q", path, expected, rec.Code, rec.Body.String())
+		}
+	}
+	for _, policy := range []string{TrailingSlashRedirect, TrailingSlashStrict} {
+		app.Setting.TrailingSlash = policy
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", "/debug?x=1", nil))
+		if rec.Code != 301 || rec.Header().Get("Location") != "/debug/?x=1" {
+			t.Fatalf("%s: expected a redirect to /debug/, got %d %v", policy, rec.Code, rec.Header())
+		}
+	}
+	for path, expected := range map[string]string{"/debug/": "/", "/debug/pprof/heap": "/pprof/heap", "/api/legacy/": "/", "/api/legacy/v1/users": "/v1/users"} {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Body.String() != expected || rec.Header().Get("X-Wrapped") != "yes" {
+			t.Fatalf("%s: expected %q, got %q", path, expected, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/boom", nil))
+	if !strings.Contains(rec.Body.String(), "Error 500") {
+		t.Fatalf("a panicking mounted handler should render the 500 page, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,259 @@
+package entropy
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//将数据渲染为某种格式的内容
+type Renderer func(ctx *Context, data interface{}, opts *NegotiateOptions) ([]byte, error)
+
+//各种媒体类型的默认渲染器,可以替换或添加新的类型
+var Renderers = map[string]Renderer{
+	"text/html":        renderHtml,
+	"application/json": renderJson,
+	"application/xml":  renderXml,
+	"text/csv":         renderCsv,
+	"text/plain":       renderText,
+}
+
+//没有指定Offers时提供的媒体类型,按服务端的偏好排列;没有设置Template时不提供html
+var DefaultOffers = []string{"text/html", "application/json", "application/xml", "text/csv", "text/plain"}
+
+//内容协商的选项
+type NegotiateOptions struct {
+	//渲染html时使用的模板,数据通过 .Data.Result 访问
+	Template string
+	//提供的媒体类型,按服务端的偏好排列,Accept中的q值相同时使用前面的类型
+	Offers []string
+	//只作用于本次协商的渲染器,优先于Renderers
+	Renderers map[string]Renderer
+}
+
+func (self *NegotiateOptions) renderer(mediaType string) (Renderer, bool) {
+	if r, ok := self.Renderers[mediaType]; ok {
+		return r, true
+	}
+	r, ok := Renderers[mediaType]
+	return r, ok
+}
+
+func (self *NegotiateOptions) offers() []string {
+	offers := self.Offers
+	if len(offers) == 0 {
+		offers = DefaultOffers
+	}
+	list := make([]string, 0, len(offers))
+	for _, offer := range offers {
+		if offer == "text/html" && self.Template == "" {
+			continue
+		}
+		if _, ok := self.renderer(offer); ok {
+			list = append(list, offer)
+		}
+	}
+	return list
+}
+
+//根据Accept头选择data的格式,没有可以接受的格式时返回406
+func (self *Context) Negotiate(data interface{}, opts NegotiateOptions) *NegotiateResult {
+	return &NegotiateResult{Context: self, Data: data, Options: opts}
+}
+
+//===========================Negotiate结果======================
+type NegotiateResult struct {
+	resultHeader
+	Context *Context
+	Data    interface{}
+	Options NegotiateOptions
+}
+
+func (self *NegotiateResult) Status(code int) *NegotiateResult {
+	self.code = code
+	return self
+}
+
+func (self *NegotiateResult) Header(key, value string) *NegotiateResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *NegotiateResult) Execute(ctx *Context) error {
+	ctx.Resp.Header().Add("Vary", "Accept")
+	offers := self.Options.offers()
+	mediaType := negotiate(ctx.Req.Header.Get("Accept"), offers)
+	if mediaType == "" {
+		ctx.Err = fmt.Errorf("可以提供的格式为: %s", strings.Join(offers, ", "))
+		panic(406)
+	}
+	render, _ := self.Options.renderer(mediaType)
+	body, err := render(ctx, self.Data, &self.Options)
+	if err != nil {
+		return err
+	}
+	ctx.Resp.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	return self.write(ctx, 200, body)
+}
+
+//===========================Negotiate结果 end======================
+
+//Accept中的一项
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+//解析Accept头,忽略格式错误的项
+func parseAccept(header string) []acceptRange {
+	ranges := make([]acceptRange, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if !strings.Contains(mediaType, "/") {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, q})
+	}
+	return ranges
+}
+
+//offer在Accept中的q值,使用最具体的匹配项:type/subtype 优先于 type/* 优先于 */*
+func acceptQuality(ranges []acceptRange, offer string) float64 {
+	best, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mediaType == offer:
+			s = 2
+		case strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(r.mediaType, "*")):
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			best, specificity = r.q, s
+		}
+	}
+	return best
+}
+
+//选择q值最高的媒体类型,q值相同时使用offers中靠前的类型;没有Accept头时使用第一个类型
+func negotiate(header string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+func renderHtml(ctx *Context, data interface{}, opts *NegotiateOptions) ([]byte, error) {
+	tpl := ctx.App.TplEngine.Lookup(opts.Template)
+	if tpl == nil {
+		return nil, errors.New("没有找到指定的模板！" + opts.Template)
+	}
+	ctx.Assign("Result", data)
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, ctx)
+	return buf.Bytes(), err
+}
+
+func renderJson(ctx *Context, data interface{}, opts *NegotiateOptions) ([]byte, error) {
+	return encodeJson(ctx, data)
+}
+
+func renderXml(ctx *Context, data interface{}, opts *NegotiateOptions) ([]byte, error) {
+	b, err := xml.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+//支持 [][]string 以及结构体的切片,结构体的字段名(或csv标签)作为第一行
+func renderCsv(ctx *Context, data interface{}, opts *NegotiateOptions) ([]byte, error) {
+	rows, err := csvRows(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.WriteAll(rows)
+	return buf.Bytes(), w.Error()
+}
+
+func renderText(ctx *Context, data interface{}, opts *NegotiateOptions) ([]byte, error) {
+	switch v := data.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	}
+	return []byte(fmt.Sprintf("%+v", data)), nil
+}
+
+//将数据转换为csv的行
+func csvRows(data interface{}) ([][]string, error) {
+	if rows, ok := data.([][]string); ok {
+		return rows, nil
+	}
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("无法将 %T 转为csv", data)
+	}
+	t := indirectType(v.Type().Elem())
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("无法将 %T 转为csv", data)
+	}
+	fields := make([]int, 0, t.NumField())
+	header := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("csv")
+		if f.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, i)
+		header = append(header, name)
+	}
+	rows := [][]string{header}
+	for i := 0; i < v.Len(); i++ {
+		elem := reflect.Indirect(v.Index(i))
+		row := make([]string, len(fields))
+		if elem.IsValid() {
+			for j, index := range fields {
+				row[j] = fmt.Sprint(elem.Field(index).Interface())
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,81 @@
+package entropy
+
+import (
+	"html/template"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type negotiateUser struct {
+	Name string `json:"name" xml:"name" csv:"name"`
+	Age  int    `json:"age" xml:"age" csv:"age"`
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		accept string
+		offers []string
+		want   string
+	}{
+		{"", []string{"application/json", "text/plain"}, "application/json"},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", []string{"text/html", "application/json"}, "text/html"},
+		{"application/json;q=0.5, application/xml", []string{"application/json", "application/xml"}, "application/xml"},
+		{"text/*;q=0.9, */*;q=0.1", []string{"application/json", "text/csv"}, "text/csv"},
+		{"text/plain;q=0, */*", []string{"text/plain", "application/json"}, "application/json"},
+		{"image/png", []string{"application/json"}, ""},
+	}
+	for _, c := range cases {
+		if got := negotiate(c.accept, c.offers); got != c.want {
+			t.Fatalf("%q: expected %q, got %q", c.accept, c.want, got)
+		}
+	}
+}
+
+func TestNegotiateResult(t *testing.T) {
+	app := newTestApplication()
+	app.TplEngine = template.Must(template.New("users.html").Parse(`{{range .Data.Result}}<li>{{.Name}}</li>{{end}}`))
+	users := []negotiateUser{{"frank", 30}}
+	app.Get("/users", "users", "", func(ctx *Context) Result {
+		return ctx.Negotiate(users, NegotiateOptions{Template: "users.html"})
+	})
+	cases := map[string]string{
+		"text/html":        "<li>frank</li>",
+		"application/json": `[{"name":"frank","age":30}]`,
+		"text/csv":         "name,age\nfrank,30\n",
+	}
+	for accept, body := range cases {
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Code != 200 || rec.Body.String() != body || !strings.HasPrefix(rec.Header().Get("Content-Type"), accept) {
+			t.Fatalf("%s: unexpected response %d %q %q", accept, rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+		if rec.Header().Get("Vary") != "Accept" {
+			t.Fatalf("%s: expected Vary: Accept, got %q", accept, rec.Header().Get("Vary"))
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Accept", "image/png")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != 406 {
+		t.Fatalf("expected 406, got %d", rec.Code)
+	}
+
+	app.Get("/custom", "custom", "", func(ctx *Context) Result {
+		return ctx.Negotiate(users, NegotiateOptions{
+			Offers: []string{"application/json"},
+			Renderers: map[string]Renderer{"application/json": func(ctx *Context, data interface{}, opts *NegotiateOptions) ([]byte, error) {
+				return []byte("custom"), nil
+			}},
+		})
+	})
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/custom", nil))
+	if rec.Body.String() != "custom" {
+		t.Fatalf("expected the custom renderer, got %q", rec.Body.String())
+	}
+}
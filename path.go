@@ -0,0 +1,64 @@
+package entropy
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+//清理路径中的 //、. 和 ..,保留末尾的/
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean(p)
+	if !strings.HasPrefix(cleaned, "/") {
+		cleaned = "/" + cleaned
+	}
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+//添加或去掉路径末尾的/,根路径返回空字符串
+func toggleTrailingSlash(p string) string {
+	if p == "/" || p == "" {
+		return ""
+	}
+	if strings.HasSuffix(p, "/") {
+		return strings.TrimSuffix(p, "/")
+	}
+	return p + "/"
+}
+
+//重定向到规范的路径并保留查询参数;GET和HEAD使用301,其余方法使用308以保留请求方法和内容
+func redirectPath(rw http.ResponseWriter, req *http.Request, p string) {
+	u := *req.URL
+	u.Path = p
+	u.RawPath = ""
+	code := http.StatusPermanentRedirect
+	if req.Method == "GET" || req.Method == "HEAD" {
+		code = http.StatusMovedPermanently
+	}
+	http.Redirect(rw, req, u.RequestURI(), code)
+}
+
+//处理末尾斜杠:路径没有匹配到任何路由时,尝试添加或去掉末尾的/;
+//策略为redirect时重定向到注册的形式,为both时直接使用匹配到的路由.返回true表示已经重定向
+func (self *Application) matchTrailingSlash(rw http.ResponseWriter, req *http.Request) (bool, *route, []string, []string) {
+	policy := self.Setting.TrailingSlash
+	alt := toggleTrailingSlash(req.URL.Path)
+	if policy == "" || policy == TrailingSlashStrict || alt == "" {
+		return false, nil, nil, nil
+	}
+	rt, params, allowed := self.getRouter().lookup(req.Method, req.Host, alt)
+	if rt == nil && allowed == nil {
+		return false, nil, nil, nil
+	}
+	if policy == TrailingSlashRedirect {
+		redirectPath(rw, req, alt)
+		return true, nil, nil, nil
+	}
+	return false, rt, params, allowed
+}
@@ -0,0 +1,66 @@
+package entropy
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	cases := map[string]string{
+		"":              "/",
+		"/":             "/",
+		"//users":       "/users",
+		"/users/./1":    "/users/1",
+		"/a/b/../c/":    "/a/c/",
+		"/../../etc":    "/etc",
+		"/users//1//":   "/users/1/",
+		"/users/1/edit": "/users/1/edit",
+	}
+	for p, expected := range cases {
+		if cleaned := cleanPath(p); cleaned != expected {
+			t.Fatalf("%q: expected %q, got %q", p, expected, cleaned)
+		}
+	}
+}
+
+func TestTrailingSlashPolicy(t *testing.T) {
+	app := newTestApplication()
+	app.Setting.CleanPath = true
+	app.Get("/users", "users", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, "users")
+	})
+	app.Post("/posts/", "posts", "", func(ctx *Context) Result {
+		return NewTextResult(ctx, "posts")
+	})
+
+	app.Setting.TrailingSlash = TrailingSlashRedirect
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/users/?page=2", nil))
+	if rec.Code != 301 || rec.Header().Get("Location") != "/users?page=2" {
+		t.Fatalf("expected a 301 to /users?page=2, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("POST", "/posts", nil))
+	if rec.Code != 308 || rec.Header().Get("Location") != "/posts/" {
+		t.Fatalf("expected a 308 to /posts/, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "//users", nil))
+	if rec.Code != 301 || rec.Header().Get("Location") != "/users" {
+		t.Fatalf("expected a 301 to /users, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	app.Setting.TrailingSlash = TrailingSlashBoth
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/users/", nil))
+	if rec.Code != 200 || rec.Body.String() != "users" {
+		t.Fatalf("expected /users/ to be served directly, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	app.Setting.TrailingSlash = TrailingSlashStrict
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/users/", nil))
+	if rec.Code != 404 {
+		t.Fatalf("expected 404 in strict mode, got %d", rec.Code)
+	}
+}
@@ -1,133 +1,544 @@
 package entropy
 
 import (
-	"bufio"
-	"encoding/json"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"image"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
-//结果接口
+func init() {
+	//系统的mime表中不一定有这两种类型,SetContentType需要使用
+	mime.AddExtensionType(".csv", "text/csv; charset=utf-8")
+	mime.AddExtensionType(".msgpack", "application/msgpack")
+}
+
+//结果接口,Execute负责写入状态码、响应头和内容.
+//返回的错误交给InternalServerErrorHandler处理,因此内置的Result先在内存中生成内容,成功后才开始写入响应
 type Result interface {
-	Execute(io.Writer)
+	Execute(ctx *Context) error
+}
+
+//内置Result共用的状态码和响应头,通过各个Result的Status和Header方法设置
+type resultHeader struct {
+	code   int
+	header http.Header
+}
+
+func (self *resultHeader) setHeader(key, value string) {
+	if self.header == nil {
+		self.header = make(http.Header)
+	}
+	self.header.Set(key, value)
+}
+
+//将设置的响应头复制到响应中,然后写入状态码,没有设置状态码时使用defaultCode
+func (self *resultHeader) writeHeader(ctx *Context, defaultCode int) {
+	self.copyHeader(ctx)
+	code := self.code
+	if code == 0 {
+		code = defaultCode
+	}
+	ctx.Resp.WriteHeader(code)
+}
+
+func (self *resultHeader) copyHeader(ctx *Context) {
+	for key, values := range self.header {
+		ctx.Resp.Header()[key] = values
+	}
+}
+
+//写入响应头、状态码和内容
+func (self *resultHeader) write(ctx *Context, defaultCode int, body []byte) error {
+	self.writeHeader(ctx, defaultCode)
+	if ctx.Req != nil && ctx.Req.Method == "HEAD" {
+		return nil
+	}
+	_, err := ctx.Resp.Write(body)
+	return err
 }
 
 //===========================Html结果======================
 func NewHtmlResult(ctx *Context, tpl string) *HtmlResult {
-	return &HtmlResult{ctx, tpl}
+	return &HtmlResult{Context: ctx, Tpl: tpl}
 }
 
 type HtmlResult struct {
+	resultHeader
 	Context *Context
 	Tpl     string
 }
 
-func (self *HtmlResult) Execute(writer io.Writer) {
-	tpl := self.Context.App.TplEngine.Lookup(self.Tpl)
+func (self *HtmlResult) Status(code int) *HtmlResult {
+	self.code = code
+	return self
+}
+
+func (self *HtmlResult) Header(key, value string) *HtmlResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *HtmlResult) Execute(ctx *Context) error {
+	tpl := ctx.App.TplEngine.Lookup(self.Tpl)
 	if tpl == nil {
-		panic("没有找到指定的模板！" + self.Tpl)
+		return errors.New("没有找到指定的模板！" + self.Tpl)
 	}
-	self.Context.Resp.SetContentType("html")
-	tpl.Execute(writer, self.Context)
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, ctx); err != nil {
+		return err
+	}
+	ctx.Resp.SetContentType("html")
+	return self.write(ctx, 200, buf.Bytes())
 }
 
 //===========================Html结果 end======================
 
 //===========================Text结果======================
 func NewTextResult(ctx *Context, content string) *TextResult {
-	return &TextResult{ctx, content}
+	return &TextResult{Context: ctx, Content: content}
 }
 
 type TextResult struct {
+	resultHeader
 	Context *Context
 	Content string
 }
 
-func (self *TextResult) Execute(writer io.Writer) {
-	self.Context.Resp.SetContentType("text")
-	writer.Write([]byte(self.Content))
+func (self *TextResult) Status(code int) *TextResult {
+	self.code = code
+	return self
+}
+
+func (self *TextResult) Header(key, value string) *TextResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *TextResult) Execute(ctx *Context) error {
+	ctx.Resp.SetContentType("text")
+	return self.write(ctx, 200, []byte(self.Content))
 }
 
 //===========================Text结果 end======================
 
 //===========================Json结果======================
 func NewJsonResult(ctx *Context, obj interface{}) *JsonResult {
-	return &JsonResult{ctx, obj}
+	return &JsonResult{Context: ctx, Object: obj}
 }
 
 type JsonResult struct {
+	resultHeader
 	Context *Context
 	Object  interface{}
 }
 
-func (self *JsonResult) Execute(writer io.Writer) {
-	self.Context.Resp.SetContentType("json")
-	b, _ := json.Marshal(self.Object)
-	writer.Write(b)
+func (self *JsonResult) Status(code int) *JsonResult {
+	self.code = code
+	return self
+}
+
+func (self *JsonResult) Header(key, value string) *JsonResult {
+	self.setHeader(key, value)
+	return self
+}
+
+//编码失败时返回500的problem+json,Debug模式下detail中包含错误原因;
+//较大的切片按照Setting.JsonStreamThreshold逐个元素编码输出
+func (self *JsonResult) Execute(ctx *Context) error {
+	if rv, ok := streamable(ctx, self.Object); ok {
+		return self.stream(ctx, rv)
+	}
+	b, err := encodeJson(ctx, self.Object)
+	if err != nil {
+		return jsonFailure(ctx, err)
+	}
+	ctx.Resp.Header().Set("Content-Type", jsonContentType)
+	return self.write(ctx, 200, b)
+}
+
+//第一个元素在写入响应之前编码,此时的错误仍然返回problem+json;
+//之后响应已经开始发送,出错时只记录日志并结束
+func (self *JsonResult) stream(ctx *Context, rv reflect.Value) error {
+	var buf bytes.Buffer
+	indent := ""
+	if setting := jsonSetting(ctx); setting.Debug {
+		indent = setting.JsonIndent
+	}
+	enc := newJsonEncoder(ctx, &buf, indent)
+	open, sep, end := "[", ",", "]"
+	if indent != "" {
+		open, sep, end = "[\n"+indent, ",\n"+indent, "\n]"
+	}
+	buf.WriteString(open)
+	if err := enc.Encode(rv.Index(0).Interface()); err != nil {
+		return jsonFailure(ctx, err)
+	}
+	ctx.Resp.Header().Set("Content-Type", jsonContentType)
+	self.writeHeader(ctx, 200)
+	if ctx.Req != nil && ctx.Req.Method == "HEAD" {
+		return nil
+	}
+	flusher, _ := ctx.Resp.ResponseWriter.(http.Flusher)
+	for i := 1; ; i++ {
+		buf.Truncate(buf.Len() - 1)
+		if i == rv.Len() {
+			buf.WriteString(end)
+		}
+		if _, err := ctx.Resp.Write(buf.Bytes()); err != nil {
+			log.Println("发送json失败:", err)
+			return nil
+		}
+		if i == rv.Len() {
+			return nil
+		}
+		if i%jsonFlushEvery == 0 && flusher != nil {
+			flusher.Flush()
+		}
+		buf.Reset()
+		buf.WriteString(sep)
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			log.Println("发送json失败:", err)
+			return nil
+		}
+	}
 }
 
 //===========================Json结果 end======================
 
 //===========================Redirect结果======================
 func NewRedirectResult(ctx *Context, url string, forever bool) *RedirectResult {
-	return &RedirectResult{ctx, url, forever}
+	return &RedirectResult{Context: ctx, url: url, forever: forever}
 }
 
 type RedirectResult struct {
+	resultHeader
 	Context *Context
 	url     string
 	forever bool
 }
 
-func (self *RedirectResult) Execute(writer io.Writer) {
-	self.Context.Resp.SetHeader("Location", self.url, true)
-	//self.Context.Resp.Write([]byte("redirecting"))
+//默认使用301或302,可以设置为303、307或308
+func (self *RedirectResult) Status(code int) *RedirectResult {
+	self.code = code
+	return self
+}
+
+func (self *RedirectResult) Header(key, value string) *RedirectResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *RedirectResult) Execute(ctx *Context) error {
+	ctx.Resp.SetHeader("Location", self.url, true)
 	if self.forever {
-		self.Context.Resp.WriteHeader(301)
+		self.writeHeader(ctx, 301)
 	} else {
-		self.Context.Resp.WriteHeader(302)
+		self.writeHeader(ctx, 302)
 	}
-
+	return nil
 }
 
 //===========================Redirect结果 end======================
 
+//===========================Status结果======================
+//只返回状态码,没有内容
+func NewStatusResult(ctx *Context, code int) *StatusResult {
+	return &StatusResult{Context: ctx, Code: code}
+}
+
+type StatusResult struct {
+	resultHeader
+	Context *Context
+	Code    int
+}
+
+func (self *StatusResult) Status(code int) *StatusResult {
+	self.Code = code
+	return self
+}
+
+func (self *StatusResult) Header(key, value string) *StatusResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *StatusResult) Execute(ctx *Context) error {
+	self.writeHeader(ctx, self.Code)
+	return nil
+}
+
+//===========================Status结果 end======================
+
 //===========================Image结果======================
 func NewImageResult(ctx *Context, img image.Image, imgType int) *ImageResult {
-	return &ImageResult{ctx, img, imgType}
+	return &ImageResult{Context: ctx, img: img, imageType: imgType}
 }
 
 type ImageResult struct {
+	resultHeader
 	Context   *Context
 	img       image.Image
 	imageType int
 }
 
-func (self *ImageResult) Execute(writer io.Writer) {
-	b := bufio.NewWriter(writer)
+func (self *ImageResult) Status(code int) *ImageResult {
+	self.code = code
+	return self
+}
+
+func (self *ImageResult) Header(key, value string) *ImageResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *ImageResult) Execute(ctx *Context) error {
+	var buf bytes.Buffer
+	var err error
+	var ext string
 	switch self.imageType {
 	case IMAGEPNG:
-		{
-			png.Encode(b, self.img)
-			self.Context.Resp.SetContentType("png")
-		}
+		err, ext = png.Encode(&buf, self.img), "png"
 	case IMAGEGIF:
-		{
-			gif.Encode(b, self.img, nil)
-			self.Context.Resp.SetContentType("gif")
-		}
+		err, ext = gif.Encode(&buf, self.img, nil), "gif"
 	case IMAGEJPEG:
-		{
-			jpeg.Encode(b, self.img, nil)
-			self.Context.Resp.SetContentType("jpeg")
-		}
+		err, ext = jpeg.Encode(&buf, self.img, nil), "jpeg"
 	default:
-		panic("错误的图片类型!")
+		return errors.New("错误的图片类型!")
 	}
-	b.Flush()
+	if err != nil {
+		return err
+	}
+	ctx.Resp.SetContentType(ext)
+	return self.write(ctx, 200, buf.Bytes())
 }
 
 //===========================Image结果 end======================
+
+//===========================Xml结果======================
+func NewXmlResult(ctx *Context, obj interface{}) *XmlResult {
+	return &XmlResult{Context: ctx, Object: obj}
+}
+
+type XmlResult struct {
+	resultHeader
+	Context *Context
+	Object  interface{}
+}
+
+func (self *XmlResult) Status(code int) *XmlResult {
+	self.code = code
+	return self
+}
+
+func (self *XmlResult) Header(key, value string) *XmlResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *XmlResult) Execute(ctx *Context) error {
+	b, err := xml.Marshal(self.Object)
+	if err != nil {
+		return err
+	}
+	ctx.Resp.SetContentType("xml")
+	return self.write(ctx, 200, append([]byte(xml.Header), b...))
+}
+
+//===========================Xml结果 end======================
+
+//===========================Jsonp结果======================
+//回调函数的名字只能是javascript的标识符,可以用.连接,如 jQuery123.cb
+var jsonpCallbackRegexp = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$]*(?:\.[a-zA-Z_$][0-9a-zA-Z_$]*)*$`)
+
+//callback通常来自查询参数,名字不合法时在处理器中返回400
+func NewJsonpResult(ctx *Context, callback string, obj interface{}) *JsonpResult {
+	if err := checkJsonpCallback(callback); err != nil {
+		ctx.Err = err
+		panic(400)
+	}
+	return &JsonpResult{Context: ctx, Callback: callback, Object: obj}
+}
+
+func checkJsonpCallback(callback string) error {
+	if len(callback) > 128 || !jsonpCallbackRegexp.MatchString(callback) {
+		return fmt.Errorf("无效的回调函数名 %q", callback)
+	}
+	return nil
+}
+
+type JsonpResult struct {
+	resultHeader
+	Context  *Context
+	Callback string
+	Object   interface{}
+}
+
+func (self *JsonpResult) Status(code int) *JsonpResult {
+	self.code = code
+	return self
+}
+
+func (self *JsonpResult) Header(key, value string) *JsonpResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *JsonpResult) Execute(ctx *Context) error {
+	//Callback在创建之后被修改为不合法的名字时作为错误返回
+	if err := checkJsonpCallback(self.Callback); err != nil {
+		return err
+	}
+	b, err := encodeJson(ctx, self.Object)
+	if err != nil {
+		return jsonFailure(ctx, err)
+	}
+	ctx.Resp.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	ctx.Resp.Header().Set("X-Content-Type-Options", "nosniff")
+	//开头的注释防止内容被当作Flash等其他格式解析
+	return self.write(ctx, 200, []byte(fmt.Sprintf("/**/ %s(%s);", self.Callback, b)))
+}
+
+//===========================Jsonp结果 end======================
+
+//===========================Csv结果======================
+//从channel中读取每一行并立即发送,channel关闭时结束
+func NewCsvResult(ctx *Context, header []string, rows <-chan []string) *CsvResult {
+	return &CsvResult{Context: ctx, header: header, next: func() ([]string, error) {
+		row, ok := <-rows
+		if !ok {
+			return nil, io.EOF
+		}
+		return row, nil
+	}, rows: rows}
+}
+
+//每次调用next获取一行并立即发送,next返回io.EOF时结束
+func NewCsvIteratorResult(ctx *Context, header []string, next func() ([]string, error)) *CsvResult {
+	return &CsvResult{Context: ctx, header: header, next: next}
+}
+
+type CsvResult struct {
+	resultHeader
+	Context *Context
+	//作为附件下载时的文件名
+	Name   string
+	header []string
+	next   func() ([]string, error)
+	rows   <-chan []string
+}
+
+func (self *CsvResult) Status(code int) *CsvResult {
+	self.code = code
+	return self
+}
+
+func (self *CsvResult) Header(key, value string) *CsvResult {
+	self.setHeader(key, value)
+	return self
+}
+
+//作为附件下载
+func (self *CsvResult) AsAttachment(name string) *CsvResult {
+	self.Name = name
+	return self
+}
+
+//第一行在写入响应之前读取,此时的错误交给InternalServerErrorHandler处理;
+//之后响应已经开始发送,出错时只记录日志并结束
+func (self *CsvResult) Execute(ctx *Context) error {
+	defer self.drain()
+	first, err := self.next()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	ctx.Resp.SetContentType("csv")
+	if self.Name != "" {
+		ctx.Resp.Header().Set("Content-Disposition", contentDisposition("attachment", self.Name))
+	}
+	self.writeHeader(ctx, 200)
+	if ctx.Req != nil && ctx.Req.Method == "HEAD" {
+		return nil
+	}
+	w := csv.NewWriter(ctx.Resp)
+	flusher, _ := ctx.Resp.ResponseWriter.(http.Flusher)
+	row := first
+	if self.header != nil {
+		w.Write(self.header)
+	}
+	for err == nil {
+		if err = w.Write(row); err != nil {
+			break
+		}
+		w.Flush()
+		if err = w.Error(); err != nil {
+			break
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		row, err = self.next()
+	}
+	w.Flush()
+	if err != io.EOF {
+		log.Println("发送csv失败:", err)
+	}
+	return nil
+}
+
+//提前结束时读完channel中剩余的行,避免生产者阻塞
+func (self *CsvResult) drain() {
+	if self.rows != nil {
+		go func() {
+			for range self.rows {
+			}
+		}()
+	}
+}
+
+//===========================Csv结果 end======================
+
+//===========================Msgpack结果======================
+func NewMsgpackResult(ctx *Context, obj interface{}) *MsgpackResult {
+	return &MsgpackResult{Context: ctx, Object: obj}
+}
+
+type MsgpackResult struct {
+	resultHeader
+	Context *Context
+	Object  interface{}
+}
+
+func (self *MsgpackResult) Status(code int) *MsgpackResult {
+	self.code = code
+	return self
+}
+
+func (self *MsgpackResult) Header(key, value string) *MsgpackResult {
+	self.setHeader(key, value)
+	return self
+}
+
+func (self *MsgpackResult) Execute(ctx *Context) error {
+	b, err := msgpack.Marshal(self.Object)
+	if err != nil {
+		return err
+	}
+	ctx.Resp.SetContentType("msgpack")
+	return self.write(ctx, 200, b)
+}
+
+//===========================Msgpack结果 end======================
@@ -0,0 +1,94 @@
+package entropy
+
+import (
+	"encoding/xml"
+	"html/template"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResultStatusAndHeader(t *testing.T) {
+	app := newTestApplication()
+	app.Post("/users", "create", "", func(ctx *Context) Result {
+		return NewJsonResult(ctx, map[string]string{"name": "不能为空"}).Status(422).Header("X-Request-Id", "42")
+	})
+	app.Get("/moved", "moved", "", func(ctx *Context) Result {
+		return NewRedirectResult(ctx, "/users", false).Status(303)
+	})
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("POST", "/users", nil))
+	if rec.Code != 422 || rec.Header().Get("X-Request-Id") != "42" || rec.Body.String() != `{"name":"不能为空"}` {
+		t.Fatalf("unexpected response %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/moved", nil))
+	if rec.Code != 303 || rec.Header().Get("Location") != "/users" {
+		t.Fatalf("unexpected redirect %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestResultErrorsGoTo500(t *testing.T) {
+	app := newTestApplication()
+	app.TplEngine = template.Must(template.New("broken.html").Parse(`partial {{.Nope.Field}}`))
+	app.Get("/html", "html", "", func(ctx *Context) Result {
+		return NewHtmlResult(ctx, "broken.html")
+	})
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/html", nil))
+	if rec.Code != 500 || strings.Contains(rec.Body.String(), "partial") || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected a clean 500 page, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestDataResults(t *testing.T) {
+	app := newTestApplication()
+	type item struct {
+		Name string `xml:"name" msgpack:"name"`
+	}
+	app.Get("/xml", "xml", "", func(ctx *Context) Result {
+		return NewXmlResult(ctx, item{"frank"}).Status(201)
+	})
+	app.Get("/jsonp", "jsonp", "", func(ctx *Context) Result {
+		return NewJsonpResult(ctx, ctx.Query("callback", ""), item{"frank"})
+	})
+	app.Get("/jsonp/broken", "jsonp_broken", "", func(ctx *Context) Result {
+		return NewJsonpResult(ctx, "cb", make(chan int))
+	})
+	app.Get("/csv", "csv", "", func(ctx *Context) Result {
+		rows := make(chan []string)
+		go func() {
+			defer close(rows)
+			for _, name := range []string{"frank", "yang"} {
+				rows <- []string{name}
+			}
+		}()
+		return NewCsvResult(ctx, []string{"name"}, rows).AsAttachment("users.csv")
+	})
+	app.Get("/msgpack", "msgpack", "", func(ctx *Context) Result {
+		return NewMsgpackResult(ctx, item{"frank"})
+	})
+	cases := []struct {
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/xml", 201, "text/xml", xml.Header + "<item><name>frank</name></item>"},
+		{"/jsonp?callback=jQuery1.cb", 200, "text/javascript", `/**/ jQuery1.cb({"Name":"frank"});`},
+		{"/jsonp?callback=alert(1)", 400, "", ""},
+		{"/jsonp/broken", 500, "application/problem+json", ""},
+		{"/csv", 200, "text/csv", "name\nfrank\nyang\n"},
+		{"/msgpack", 200, "application/msgpack", "\x81\xa4name\xa5frank"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest("GET", c.path, nil))
+		if rec.Code != c.code || !strings.HasPrefix(rec.Header().Get("Content-Type"), c.contentType) {
+			t.Fatalf("%s: unexpected response %d %q", c.path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if c.body != "" && rec.Body.String() != c.body {
+			t.Fatalf("%s: unexpected body %q", c.path, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package entropy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+//生成url的选项
+type URLOptions struct {
+	//按名字提供的参数,包括域名中的参数;不属于路径和域名的参数加入查询字符串
+	Params map[string]interface{}
+	//查询参数
+	Query url.Values
+	//锚点,不包含#
+	Fragment string
+	//是否生成包含协议和域名的绝对地址
+	Absolute bool
+}
+
+//按名字填充域名和路径中的参数,返回域名、路径以及多余的参数
+func (self *Application) reverseParams(name string, params map[string]interface{}) (string, string, url.Values, error) {
+	spec, hostPattern, prefix, ok := self.findNamedHandler(name)
+	if !ok {
+		return "", "", nil, fmt.Errorf("处理器 %s 没有找到", name)
+	}
+	used := make(map[string]bool)
+	host := ""
+	if hostPattern != "" {
+		hp := newHostPattern(hostPattern)
+		args := make([]interface{}, 0, len(hp.Names))
+		for _, n := range hp.Names {
+			arg, exist := params[n]
+			if !exist {
+				return "", "", nil, fmt.Errorf("处理器 %s 缺少域名参数 %s", name, n)
+			}
+			args = append(args, arg)
+			used[n] = true
+		}
+		var err error
+		if host, err = hp.fill(args); err != nil {
+			return "", "", nil, err
+		}
+	}
+	path, err := spec.Build(params)
+	if err != nil {
+		return "", "", nil, err
+	}
+	for _, n := range spec.ParamNames {
+		used[n] = true
+	}
+	extra := make(url.Values)
+	for key, arg := range params {
+		if used[key] {
+			continue
+		}
+		value, err := formatParam(arg)
+		if err != nil {
+			return "", "", nil, err
+		}
+		extra.Add(key, value)
+	}
+	return host, joinPattern(prefix, path), extra, nil
+}
+
+//在路径后面加上查询字符串和锚点
+func (self URLOptions) finish(path string, extra url.Values) string {
+	query := make(url.Values)
+	for key, values := range extra {
+		query[key] = append(query[key], values...)
+	}
+	for key, values := range self.Query {
+		query[key] = append(query[key], values...)
+	}
+	u := url.URL{Path: path, RawQuery: query.Encode(), Fragment: self.Fragment}
+	//路径已经转义过,避免再次转义
+	u.RawPath = path
+	if p, err := url.PathUnescape(path); err == nil {
+		u.Path = p
+	}
+	return u.String()
+}
+
+//根据处理器的名字和参数生成url;绑定了域名的处理器返回与协议无关的绝对地址,
+//没有请求可以参考,因此请求绝对地址时处理器必须绑定了域名
+func (self *Application) URLFor(name string, opts URLOptions) (string, error) {
+	host, path, extra, err := self.reverseParams(name, opts.Params)
+	if err != nil {
+		return "", err
+	}
+	if opts.Absolute && host == "" {
+		return "", errors.New(fmt.Sprintf("处理器 %s 没有绑定域名, 无法生成绝对地址", name))
+	}
+	u := opts.finish(path, extra)
+	if host != "" {
+		return "//" + host + u, nil
+	}
+	return u, nil
+}
+
+//根据处理器的名字和参数生成url,绝对地址使用当前请求的协议和域名;
+//处理器绑定的域名与当前请求的域名不同时,总是返回绝对地址
+func (self *Context) URLFor(name string, opts URLOptions) (string, error) {
+	host, path, extra, err := self.App.reverseParams(name, opts.Params)
+	if err != nil {
+		return "", err
+	}
+	return self.absolute(host, opts.Absolute, opts.finish(path, extra)), nil
+}
+
+//为路径加上协议和域名
+func (self *Context) absolute(host string, force bool, path string) string {
+	current := ""
+	if self.Req != nil {
+		current = strings.ToLower(stripPort(self.Req.Host))
+	}
+	if host != "" && host != current {
+		return self.Scheme() + "://" + host + self.port() + path
+	}
+	if force && self.Req != nil {
+		return self.Scheme() + "://" + self.Req.Host + path
+	}
+	return path
+}
+
+//模板中生成url失败时的处理:严格模式下panic,模板的执行随之失败;否则记录日志并返回空字符串
+func (self *Application) urlError(name string, err error) string {
+	if self.Setting != nil && self.Setting.StrictURL {
+		panic(err)
+	}
+	log.Printf("生成 %s 的url失败: %v", name, err)
+	return ""
+}
@@ -0,0 +1,647 @@
+package entropy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+//路由树中节点的类型,同时也是匹配的优先级:静态片段 > 参数(:id, int:id, {id:[0-9]+}) > 正则片段 > 通配符(*file, path:file).
+//自定义正则中不能包含/
+const (
+	staticNode = iota
+	paramNode
+	regexNode
+	wildcardNode
+)
+
+//路由表中的一条记录
+type route struct {
+	//HTTP方法,空字符串表示接受任意方法
+	Method string
+	//完整的路径,包含Blueprint的前缀
+	Pattern string
+	//完整的名字,Blueprint中的处理器为 bp.name
+	Endpoint string
+	//绑定的域名,为nil时匹配任意域名
+	Host *hostPattern
+	//传给处理器的参数的名字,域名中的参数在前,路径中的参数在后
+	ParamNames []string
+	Spec       *URLSpec
+	//处理器所在的Blueprint,嵌套时为最内层的Blueprint
+	Blueprint *Blueprint
+	//从最外层到最内层的所有Blueprint
+	Blueprints []*Blueprint
+	//通过Mount挂载的http.Handler,此时Spec为nil
+	Mount http.Handler
+	//挂载的前缀,转发请求时从路径中去掉
+	MountPrefix string
+	//所在Blueprint的完整名字,如 api.v1
+	BlueprintName string
+}
+
+//用于错误信息中描述该路由
+func (self *route) String() string {
+	method := self.Method
+	if method == "" {
+		method = "ANY"
+	}
+	name := self.Endpoint
+	if self.Mount != nil {
+		name = "mount " + self.MountPrefix
+	}
+	pattern := self.Pattern
+	if self.Host != nil {
+		pattern = self.Host.Pattern + pattern
+	}
+	return fmt.Sprintf("%s %s (%s)", method, pattern, name)
+}
+
+//路由树节点,每个节点对应路径中以/分隔的一个片段
+type node struct {
+	kind int
+	//片段原文
+	segment string
+	//参数片段与正则片段编译后的表达式
+	regex *regexp.Regexp
+	//参数片段的类型
+	converter string
+	//正则片段中传给处理器的分组序号
+	groups []int
+	//去掉分组名等差异后的正则,用于发现等价的参数片段和正则片段
+	canonical string
+	//静态子节点,按片段直接索引
+	static map[string]*node
+	//参数子节点与正则子节点,按片段原文排序以保证匹配顺序固定
+	params   []*node
+	regexps  []*node
+	wildcard *node
+	//路径在此节点结束时对应的路由,按HTTP方法索引
+	routes map[string]*route
+}
+
+//绑定到某个域名的路由树
+type hostRouter struct {
+	host *hostPattern
+	root *node
+}
+
+//编译后的路由树
+type router struct {
+	//不绑定域名的路由
+	root *node
+	//绑定域名的路由,不含参数的域名在前,优先于不绑定域名的路由匹配
+	hosts  []*hostRouter
+	routes []*route
+	//编译时发现的冲突及错误
+	conflicts []string
+}
+
+func newNode(kind int, segment string) *node {
+	return &node{kind: kind, segment: segment, static: make(map[string]*node), routes: make(map[string]*route)}
+}
+
+//根据Application及其Blueprint中注册的处理器构造路由树.
+//map的遍历顺序是随机的,所以先按名字排序,保证每次编译结果一致.
+//两个路由匹配完全相同的路径和方法,或者一个路由永远会先于另一个路由匹配时,返回描述所有冲突的错误
+func newRouter(app *Application) (*router, error) {
+	r := &router{root: newNode(staticNode, "")}
+	for _, name := range sortedBlueprintNames(app.Blueprints) {
+		r.addBlueprint(name, "", "", nil, app.Blueprints[name])
+	}
+	for _, spec := range sortedSpecs(app.NamedHandlers) {
+		r.add(&route{Method: spec.Method, Pattern: joinPattern("", spec.Pattern), Endpoint: spec.Name, Spec: spec})
+	}
+	r.addMounts("", nil, "", app.Mounts, nil)
+	for _, hr := range r.hosts {
+		hr.root.checkShadowed(r)
+	}
+	r.root.checkShadowed(r)
+	if len(r.conflicts) > 0 {
+		return r, errors.New("路由表错误:\n\t" + strings.Join(r.conflicts, "\n\t"))
+	}
+	return r, nil
+}
+
+//添加Blueprint及其子Blueprint中的处理器,子Blueprint的前缀叠加在父Blueprint的前缀之后;
+//子Blueprint没有设置Host时继承父Blueprint的Host
+func (self *router) addBlueprint(name string, host string, prefix string, parents []*Blueprint, bp *Blueprint) {
+	prefix = joinPattern(prefix, bp.Prefix)
+	if bp.Host != "" {
+		host = bp.Host
+	}
+	var hp *hostPattern
+	if host != "" {
+		hp = newHostPattern(host)
+	}
+	chain := make([]*Blueprint, 0, len(parents)+1)
+	chain = append(append(chain, parents...), bp)
+	for _, childName := range sortedBlueprintNames(bp.Blueprints) {
+		self.addBlueprint(name+"."+childName, host, prefix, chain, bp.Blueprints[childName])
+	}
+	for _, spec := range sortedSpecs(bp.NamedHandlers) {
+		self.add(&route{Method: spec.Method, Pattern: joinPattern(prefix, spec.Pattern), Endpoint: name + "." + spec.Name, Host: hp, Spec: spec, Blueprint: bp, Blueprints: chain, BlueprintName: name})
+	}
+	self.addMounts(name, hp, prefix, bp.Mounts, chain)
+}
+
+func sortedBlueprintNames(blueprints map[string]*Blueprint) []string {
+	names := make([]string, 0, len(blueprints))
+	for name := range blueprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedSpecs(specs map[string]*URLSpec) []*URLSpec {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]*URLSpec, 0, len(names))
+	for _, name := range names {
+		list = append(list, specs[name])
+	}
+	return list
+}
+
+//将Blueprint前缀与处理器的路径拼接,并去掉^和$
+func joinPattern(prefix string, pattern string) string {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+	if prefix == "" {
+		return pattern
+	}
+	if strings.HasSuffix(prefix, "/") && strings.HasPrefix(pattern, "/") {
+		return prefix + pattern[1:]
+	}
+	return prefix + pattern
+}
+
+//将路径拆分为片段,/users/ 拆分为 ["users", ""],以保证末尾的/也参与匹配
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+//挂载的http.Handler匹配前缀/及前缀下的所有路径,前缀/转发为/;
+//不带末尾斜杠的前缀本身重定向到前缀/,与http.StripPrefix的用法一致
+func (self *router) addMounts(bpName string, host *hostPattern, prefix string, mounts map[string]http.Handler, chain []*Blueprint) {
+	var bp *Blueprint
+	if len(chain) > 0 {
+		bp = chain[len(chain)-1]
+	}
+	prefixes := make([]string, 0, len(mounts))
+	for p := range mounts {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	for _, p := range prefixes {
+		full := strings.TrimSuffix(joinPattern(prefix, p), "/")
+		if full != "" {
+			self.add(&route{Pattern: full, Host: host, Blueprint: bp, Blueprints: chain, BlueprintName: bpName, Mount: mounts[p], MountPrefix: full})
+		}
+		self.add(&route{Pattern: full + "/", Host: host, Blueprint: bp, Blueprints: chain, BlueprintName: bpName, Mount: mounts[p], MountPrefix: full})
+		self.add(&route{Pattern: full + "/*path", Host: host, Blueprint: bp, Blueprints: chain, BlueprintName: bpName, Mount: mounts[p], MountPrefix: full})
+	}
+}
+
+//判断片段中是否含有正则表达式的元字符
+func isRegexSegment(segment string) bool {
+	return strings.ContainsAny(segment, `\+*?()|[]{}^$`)
+}
+
+//判断片段的类型:整个片段是一个参数时为参数节点,path类型的参数为通配节点,其余含有参数或正则的片段为正则节点
+func segmentKind(segment string) (int, *pathParam) {
+	params := parsePathParams(segment)
+	if len(params) == 1 && params[0].start == 0 && params[0].end == len(segment) {
+		if params[0].Type == "path" {
+			return wildcardNode, &params[0]
+		}
+		return paramNode, &params[0]
+	}
+	if len(params) > 0 || isRegexSegment(segment) {
+		return regexNode, nil
+	}
+	return staticNode, nil
+}
+
+//同一位置有多个参数节点时的匹配顺序,自定义正则最先,其余类型越严格越靠前
+var converterRank = map[string]int{"": 0, "int": 1, "uuid": 2, "float": 3, "slug": 4, "str": 5}
+
+//前一种类型能匹配后一种类型能匹配的所有片段,后者排在前者之后时永远不会被匹配
+var converterCovers = map[string]string{"str": "slug"}
+
+//向路由树中添加一条路由,如果该路径与方法已经存在,记录冲突并保留先添加的路由
+func (self *router) add(rt *route) {
+	//直接写入NamedHandlers的处理器没有经过Handle,在这里生成调用计划
+	if rt.Spec != nil && rt.Spec.plan == nil {
+		rt.Spec.mustPlan()
+	}
+	if rt.Host != nil {
+		rt.ParamNames = append(rt.ParamNames, rt.Host.Names...)
+	}
+	if rt.Spec != nil {
+		rt.ParamNames = append(rt.ParamNames, rt.Spec.ParamNames...)
+		//域名中的参数在注册处理器时还不确定,在这里检查参数个数
+		if len(rt.Spec.plan.decoders) != len(rt.ParamNames) {
+			self.conflicts = append(self.conflicts, fmt.Sprintf("%s 的处理器需要 %d 个参数, 但是域名和路径中有 %d 个参数 %v",
+				rt, len(rt.Spec.plan.decoders), len(rt.ParamNames), rt.ParamNames))
+			return
+		}
+	}
+	segments := splitPath(rt.Pattern)
+	//先检查整个路径,出错时不在路由树中留下多余的节点
+	for i, segment := range segments {
+		if kind, _ := segmentKind(segment); kind == wildcardNode && i != len(segments)-1 {
+			self.conflicts = append(self.conflicts, fmt.Sprintf("%s 中的通配符 %s 必须位于最后", rt, segment))
+			return
+		}
+	}
+	current := self.hostRoot(rt.Host)
+	for _, segment := range segments {
+		kind, param := segmentKind(segment)
+		current = current.child(kind, segment, param)
+	}
+	if exist, ok := current.routes[rt.Method]; ok {
+		self.conflicts = append(self.conflicts, fmt.Sprintf("%s 与 %s 匹配完全相同的路径", rt, exist))
+		return
+	}
+	current.routes[rt.Method] = rt
+	self.routes = append(self.routes, rt)
+}
+
+//获取域名对应的路由树,不存在时创建
+func (self *router) hostRoot(host *hostPattern) *node {
+	if host == nil {
+		return self.root
+	}
+	for _, hr := range self.hosts {
+		if hr.host.Pattern == host.Pattern {
+			return hr.root
+		}
+	}
+	hr := &hostRouter{host: host, root: newNode(staticNode, "")}
+	self.hosts = append(self.hosts, hr)
+	sort.SliceStable(self.hosts, func(i, j int) bool {
+		a, b := self.hosts[i].host, self.hosts[j].host
+		if (len(a.Names) == 0) != (len(b.Names) == 0) {
+			return len(a.Names) == 0
+		}
+		return a.Pattern < b.Pattern
+	})
+	return hr.root
+}
+
+//检查被遮蔽的参数路由和正则路由,同一位置上:
+//	1. 前一个参数节点的类型包含后一个的类型,如 /a/slug:s 与 /a/:name,后者能匹配的路径总是先被前者匹配
+//	2. 两个参数节点或两个正则节点的正则等价,如 /b/(\d+) 与 /b/([0-9]+)、/c/int:id 与 /c/{id:-?\d+}
+//一个正则只匹配另一个正则的一部分(如 {x:[a-z]+} 与 :y)时两者都可能被匹配,不会报告;
+//除了str包含slug之外,一个正则是否完全包含另一个正则(如 {x:[^/]+} 排在 :y 之前)也不会检查
+func (self *node) checkShadowed(r *router) {
+	for i, b := range self.params {
+		for _, a := range self.params[:i] {
+			if converterCovers[b.converter] == a.converter || a.canonical == b.canonical {
+				b.reportShadowed(r, a)
+			}
+		}
+	}
+	for i, b := range self.regexps {
+		for _, a := range self.regexps[:i] {
+			if a.canonical == b.canonical {
+				b.reportShadowed(r, a)
+			}
+		}
+	}
+	for _, segment := range sortedKeys(self.static) {
+		self.static[segment].checkShadowed(r)
+	}
+	for _, n := range self.params {
+		n.checkShadowed(r)
+	}
+	for _, n := range self.regexps {
+		n.checkShadowed(r)
+	}
+}
+
+//在此节点结束的路由与a中同一方法(或任意方法)的路由冲突时记录
+func (self *node) reportShadowed(r *router, a *node) {
+	for _, method := range sortedMethods(self.routes) {
+		shadow, ok := a.routes[method]
+		if !ok {
+			shadow, ok = a.routes[""]
+		}
+		if ok {
+			r.conflicts = append(r.conflicts, fmt.Sprintf("%s 永远不会被匹配, 它被 %s 遮蔽", self.routes[method], shadow))
+		}
+	}
+}
+
+//将正则化简为规范形式:去掉捕获分组,\d与[0-9]等写法统一;无法解析时返回原文
+func canonicalRegex(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return expr
+	}
+	return stripCaptures(re).Simplify().String()
+}
+
+func stripCaptures(re *syntax.Regexp) *syntax.Regexp {
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	for i, sub := range re.Sub {
+		re.Sub[i] = stripCaptures(sub)
+	}
+	return re
+}
+
+func sortedMethods(routes map[string]*route) []string {
+	methods := make([]string, 0, len(routes))
+	for method := range routes {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func sortedKeys(nodes map[string]*node) []string {
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//查找或创建子节点
+func (self *node) child(kind int, segment string, param *pathParam) *node {
+	switch kind {
+	case staticNode:
+		if n, ok := self.static[segment]; ok {
+			return n
+		}
+		n := newNode(kind, segment)
+		self.static[segment] = n
+		return n
+	case paramNode:
+		//参数名不影响匹配,同一位置、同一正则的参数共用一个节点
+		for _, n := range self.params {
+			if n.segment == param.Regex {
+				return n
+			}
+		}
+		n := newNode(kind, param.Regex)
+		n.converter = param.Type
+		n.regex = regexp.MustCompile("^(?:" + param.Regex + ")$")
+		n.canonical = canonicalRegex(param.Regex)
+		self.params = append(self.params, n)
+		sort.SliceStable(self.params, func(i, j int) bool {
+			a, b := self.params[i], self.params[j]
+			if converterRank[a.converter] != converterRank[b.converter] {
+				return converterRank[a.converter] < converterRank[b.converter]
+			}
+			return a.segment < b.segment
+		})
+		return n
+	case regexNode:
+		for _, n := range self.regexps {
+			if n.segment == segment {
+				return n
+			}
+		}
+		n := newNode(kind, segment)
+		n.regex = regexp.MustCompile("^" + pathToRegexp(segment) + "$")
+		n.groups, _ = captureGroups(n.regex)
+		n.canonical = canonicalRegex(pathToRegexp(segment))
+		self.regexps = append(self.regexps, n)
+		sort.Slice(self.regexps, func(i, j int) bool { return self.regexps[i].segment < self.regexps[j].segment })
+		return n
+	default:
+		if self.wildcard == nil {
+			self.wildcard = newNode(kind, segment)
+		}
+		return self.wildcard
+	}
+}
+
+//判断参数节点是否接受该片段,字符串类型不经过正则以加快匹配
+func (self *node) accept(segment string) bool {
+	if self.converter == "str" {
+		return segment != "" && isWord(segment)
+	}
+	return self.regex.MatchString(segment)
+}
+
+//按优先级依次尝试子节点,失败时回溯;返回路径匹配的节点,HTTP方法在匹配之后再做选择
+func (self *node) match(segments []string, values []string) (*node, []string) {
+	if len(segments) == 0 {
+		if len(self.routes) == 0 {
+			return nil, values
+		}
+		return self, values
+	}
+	segment, rest := segments[0], segments[1:]
+	if n, ok := self.static[segment]; ok {
+		if rt, v := n.match(rest, values); rt != nil {
+			return rt, v
+		}
+	}
+	for _, n := range self.params {
+		if n.accept(segment) {
+			if rt, v := n.match(rest, append(values, segment)); rt != nil {
+				return rt, v
+			}
+		}
+	}
+	for _, n := range self.regexps {
+		if sub := n.regex.FindStringSubmatch(segment); sub != nil {
+			v := values
+			for _, i := range n.groups {
+				v = append(v, sub[i])
+			}
+			if rt, v := n.match(rest, v); rt != nil {
+				return rt, v
+			}
+		}
+	}
+	if self.wildcard != nil && len(self.wildcard.routes) > 0 {
+		if rest := strings.Join(segments, "/"); rest != "" {
+			return self.wildcard, append(values, rest)
+		}
+	}
+	return nil, values
+}
+
+//与正则表达式\w+等价
+func isWord(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+//根据HTTP方法选择路由:优先选择方法一致的路由,HEAD请求可由GET处理,最后选择接受任意方法的路由
+func (self *node) route(method string) *route {
+	if rt, ok := self.routes[method]; ok {
+		return rt
+	}
+	if method == "HEAD" {
+		if rt, ok := self.routes["GET"]; ok {
+			return rt
+		}
+	}
+	return self.routes[""]
+}
+
+//该路径允许的HTTP方法,用于Allow头
+func (self *node) allowed() []string {
+	methods := []string{"OPTIONS"}
+	for method := range self.routes {
+		if method != "OPTIONS" {
+			methods = append(methods, method)
+		}
+		if method == "GET" {
+			if _, ok := self.routes["HEAD"]; !ok {
+				methods = append(methods, "HEAD")
+			}
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+//查找符合请求路径与方法的路由,返回路由与路径中的参数;
+//如果路径匹配而方法不匹配,路由为nil,同时返回该路径允许的方法
+func (self *router) lookup(method string, host string, path string) (*route, []string, []string) {
+	segments := splitPath(path)
+	var n *node
+	var values []string
+	//先查找绑定了域名的路由,域名中的参数位于路径参数之前
+	for _, hr := range self.hosts {
+		if hostValues, ok := hr.host.match(host); ok {
+			if n, values = hr.root.match(segments, hostValues); n != nil {
+				break
+			}
+		}
+	}
+	if n == nil {
+		n, values = self.root.match(segments, make([]string, 0, 4))
+	}
+	if n == nil {
+		return nil, nil, nil
+	}
+	if rt := n.route(method); rt != nil {
+		return rt, values, nil
+	}
+	return nil, nil, n.allowed()
+}
+
+//找到符合当前请求的处理器
+func (self *Application) findMatchedRequestHandler(req *http.Request) (*route, []string, []string) {
+	return self.getRouter().lookup(req.Method, req.Host, req.URL.Path)
+}
+
+//获取路由树,第一次请求时编译;此后通过Handle添加处理器会使其重新编译.路由存在冲突时panic
+func (self *Application) getRouter() *router {
+	self.routerLock.RLock()
+	r := self.router
+	self.routerLock.RUnlock()
+	if r != nil {
+		return r
+	}
+	if err := self.Compile(); err != nil {
+		panic(err)
+	}
+	return self.getRouter()
+}
+
+//编译路由树并检查冲突,Go会在启动前调用;也可以在测试中调用以尽早发现冲突
+func (self *Application) Compile() error {
+	r, err := newRouter(self)
+	if err != nil {
+		return err
+	}
+	self.routerLock.Lock()
+	self.router = r
+	self.routerLock.Unlock()
+	return nil
+}
+
+//使已编译的路由树及包裹后的处理器失效
+func (self *Application) resetRouter() {
+	self.routerLock.Lock()
+	self.router = nil
+	self.handler = nil
+	self.routerLock.Unlock()
+}
+
+//路由表中一条路由的描述
+type RouteInfo struct {
+	//HTTP方法,接受任意方法时为ANY
+	Method string
+	//包含所有Blueprint前缀的完整路径
+	Pattern string
+	//完整的名字,可用于Reverse,如 api.v1.users.show
+	Name  string
+	CName string
+	//所在Blueprint的完整名字,如 api.v1
+	Blueprint string
+	//绑定的域名,如 {tenant}.example.com
+	Host string
+	//按执行顺序排列的filter和中间件,如 "before main.requireLogin"
+	Filters []string
+	//是否为通过Mount挂载的http.Handler
+	Mounted bool
+}
+
+//返回完整的路由表,按域名、路径和方法排序
+func (self *Application) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0)
+	for _, rt := range self.getRouter().routes {
+		info := RouteInfo{Method: rt.Method, Pattern: rt.Pattern, Name: rt.Endpoint, Blueprint: rt.BlueprintName, Mounted: rt.Mount != nil}
+		if info.Method == "" {
+			info.Method = "ANY"
+		}
+		if rt.Host != nil {
+			info.Host = rt.Host.Pattern
+		}
+		if rt.Spec != nil {
+			info.CName = rt.Spec.CName
+			info.Filters = self.describeFilters(rt)
+		}
+		routes = append(routes, info)
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+//按执行顺序描述作用于该路由的filter和中间件
+func (self *Application) describeFilters(rt *route) []string {
+	filters := describeFilters("before", filtersOf(self.BeforeFilters), self.beforeNames)
+	filters = append(filters, describeFilters("around", middlewaresOf(self.Middlewares), self.middlewareNames)...)
+	for _, bp := range rt.Blueprints {
+		filters = append(filters, describeFilters("before", filtersOf(bp.BeforeFilters), bp.beforeNames)...)
+		filters = append(filters, describeFilters("around", middlewaresOf(bp.Middlewares), bp.middlewareNames)...)
+	}
+	filters = append(filters, describeFilters("around", middlewaresOf(rt.Spec.Middlewares), nil)...)
+	for i := len(rt.Blueprints) - 1; i >= 0; i-- {
+		filters = append(filters, describeFilters("after", filtersOf(rt.Blueprints[i].AfterFilters), rt.Blueprints[i].afterNames)...)
+	}
+	return append(filters, describeFilters("after", filtersOf(self.AfterFilters), self.afterNames)...)
+}
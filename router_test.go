@@ -0,0 +1,264 @@
+package entropy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//构造一个接受n个字符串路径参数的处理器
+func testHandler(n int) Handler {
+	in := []reflect.Type{reflect.TypeOf(&Context{})}
+	for i := 0; i < n; i++ {
+		in = append(in, reflect.TypeOf(""))
+	}
+	out := []reflect.Type{reflect.TypeOf((*Result)(nil)).Elem()}
+	fn := reflect.MakeFunc(reflect.FuncOf(in, out, false), func(args []reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.Zero(out[0])}
+	})
+	return fn.Interface()
+}
+
+func newTestApplication() *Application {
+	return &Application{
+		NamedHandlers: make(map[string]*URLSpec),
+		Blueprints:    make(map[string]*Blueprint),
+		Mounts:        make(map[string]http.Handler),
+		ErrorHandlers: ErrHandlers,
+		Setting:       &Setting{StaticDir: "static"},
+	}
+}
+
+func TestRouterPrecedence(t *testing.T) {
+	app := newTestApplication()
+	app.Handle("/users/:id", "user", "", testHandler(1))
+	app.Handle("/users/new", "new_user", "", testHandler(0))
+	app.Handle("/users/(\\d+)-:slug", "user_slug", "", testHandler(2))
+	app.Handle("/files/*path", "files", "", testHandler(1))
+	bp := NewBlueprint("/admin")
+	bp.Handle("/users/:id", "user", "", testHandler(1))
+	app.Blueprint("admin", bp)
+
+	cases := []struct {
+		path   string
+		name   string
+		params []string
+	}{
+		{"/users/new", "new_user", []string{}},
+		{"/users/42", "user", []string{"42"}},
+		{"/users/42-hello", "user_slug", []string{"42", "hello"}},
+		{"/files/css/site.css", "files", []string{"css/site.css"}},
+		{"/admin/users/7", "user", []string{"7"}},
+		{"/users/", "", nil},
+		{"/nothing", "", nil},
+	}
+	for i := 0; i < 10; i++ {
+		app.resetRouter()
+		for _, c := range cases {
+			rt, params, _ := app.getRouter().lookup("GET", "", c.path)
+			if c.name == "" {
+				if rt != nil {
+					t.Fatalf("%s: expected no match, got %s", c.path, rt.Spec.Name)
+				}
+				continue
+			}
+			if rt == nil || rt.Spec.Name != c.name {
+				t.Fatalf("%s: expected %s, got %v", c.path, c.name, rt)
+			}
+			if strings.Join(params, ",") != strings.Join(c.params, ",") {
+				t.Fatalf("%s: expected params %v, got %v", c.path, c.params, params)
+			}
+		}
+	}
+}
+
+func TestRouterTypedParams(t *testing.T) {
+	app := newTestApplication()
+	app.Get("/items/int:id", "item", "", testHandler(1))
+	app.Get("/items/uuid:key", "item_uuid", "", testHandler(1))
+	app.Get("/items/slug:slug", "item_slug", "", testHandler(1))
+	app.Get("/prices/float:price", "price", "", testHandler(1))
+	app.Get("/archive/{year:[0-9]{4}}/:title", "archive", "", testHandler(2))
+	app.Get("/docs/path:file", "docs", "", testHandler(1))
+	app.Get("/int/int:id", "only_int", "", testHandler(1))
+
+	cases := []struct {
+		path   string
+		name   string
+		params []string
+	}{
+		{"/items/42", "item", []string{"42"}},
+		{"/items/123e4567-e89b-12d3-a456-426614174000", "item_uuid", []string{"123e4567-e89b-12d3-a456-426614174000"}},
+		{"/items/hello-world", "item_slug", []string{"hello-world"}},
+		{"/prices/9.95", "price", []string{"9.95"}},
+		{"/archive/2014/hello", "archive", []string{"2014", "hello"}},
+		{"/archive/14/hello", "", nil},
+		{"/docs/guide/intro.md", "docs", []string{"guide/intro.md"}},
+		{"/int/abc", "", nil},
+	}
+	r := app.getRouter()
+	for _, c := range cases {
+		rt, params, _ := r.lookup("GET", "", c.path)
+		if c.name == "" {
+			if rt != nil {
+				t.Fatalf("%s: expected no match, got %s", c.path, rt.Spec.Name)
+			}
+			continue
+		}
+		if rt == nil || rt.Spec.Name != c.name {
+			t.Fatalf("%s: expected %s, got %v", c.path, c.name, rt)
+		}
+		if strings.Join(params, ",") != strings.Join(c.params, ",") {
+			t.Fatalf("%s: expected params %v, got %v", c.path, c.params, params)
+		}
+	}
+}
+
+func TestRouterRegexGroups(t *testing.T) {
+	app := newTestApplication()
+	app.Handle("/article/(\\d+)", "article", "", func(ctx *Context, id int) Result {
+		return NewTextResult(ctx, fmt.Sprintf("%d %s", id, ctx.Param("$1")))
+	})
+	app.Handle("/lang/{code:(en|zh)}/(\\w+)", "lang", "", testHandler(2))
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("GET", "/article/42", nil))
+	if rec.Body.String() != "42 42" {
+		t.Fatalf("unexpected response %q", rec.Body.String())
+	}
+	//参数正则内部的分组不单独传给处理器
+	rt, params, _ := app.getRouter().lookup("GET", "", "/lang/zh/intro")
+	if rt == nil || strings.Join(params, ",") != "zh,intro" || strings.Join(rt.ParamNames, ",") != "code,$2" {
+		t.Fatalf("unexpected match %v %v", rt, params)
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	app := newTestApplication()
+	app.Get("/posts/:id", "show", "", testHandler(1))
+	app.Put("/posts/:id", "update", "", testHandler(1))
+	app.Any("/anything", "anything", "", testHandler(0))
+	r := app.getRouter()
+	if rt, _, _ := r.lookup("PUT", "", "/posts/1"); rt == nil || rt.Spec.Name != "update" {
+		t.Fatalf("PUT should match update, got %v", rt)
+	}
+	if rt, _, _ := r.lookup("HEAD", "", "/posts/1"); rt == nil || rt.Spec.Name != "show" {
+		t.Fatalf("HEAD should fall back to GET, got %v", rt)
+	}
+	if rt, _, _ := r.lookup("DELETE", "", "/anything"); rt == nil {
+		t.Fatal("Any should accept DELETE")
+	}
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("DELETE", "/posts/1", nil))
+	if rec.Code != 405 || rec.Header().Get("Allow") != "GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf("expected 405 with Allow header, got %d %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/posts/1", nil))
+	if rec.Code != 204 || rec.Header().Get("Allow") != "GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf("expected 204 with Allow header, got %d %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func benchmarkApplication(n int) *Application {
+	app := newTestApplication()
+	for i := 0; i < n; i++ {
+		app.Handle(fmt.Sprintf("/section%d/item/:id", i), fmt.Sprintf("route%d", i), "", testHandler(1))
+	}
+	return app
+}
+
+func BenchmarkRouterLookup1000(b *testing.B) {
+	app := benchmarkApplication(1000)
+	r := app.getRouter()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if rt, _, _ := r.lookup("GET", "", "/section999/item/42"); rt == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
+//旧的实现:逐个执行正则表达式
+func BenchmarkRegexScan1000(b *testing.B) {
+	app := benchmarkApplication(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var found *URLSpec
+		for _, spec := range app.NamedHandlers {
+			if spec.Regex.MatchString("/section999/item/42") {
+				found = spec
+				break
+			}
+		}
+		if found == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func TestRouterConflicts(t *testing.T) {
+	app := newTestApplication()
+	app.Get("/users/:id", "user", "", testHandler(1))
+	app.Get("/users/:name", "user_by_name", "", testHandler(1))
+	app.Get("/pages/slug:slug", "page", "", testHandler(1))
+	app.Get("/pages/:name", "page_by_name", "", testHandler(1))
+	app.Post("/pages/:name", "create_page", "", testHandler(1))
+	app.Get("/b/(\\d+)", "b_digits", "", testHandler(1))
+	app.Get("/b/([0-9]+)", "b_range", "", testHandler(1))
+	app.Get("/c/int:id", "c_int", "", testHandler(1))
+	app.Get("/c/{id:-?\\d+}", "c_custom", "", testHandler(1))
+	app.Get("/d/{x:[a-z]+}", "d_lower", "", testHandler(1))
+	app.Get("/d/:y", "d_str", "", testHandler(1))
+	app.Get("/e/*path/edit", "e_edit", "", testHandler(1))
+	err := app.Compile()
+	if err == nil {
+		t.Fatal("expected conflicts")
+	}
+	for _, expected := range []string{
+		"GET /users/:name (user_by_name) 与 GET /users/:id (user)",
+		"GET /pages/:name (page_by_name) 永远不会被匹配, 它被 GET /pages/slug:slug (page) 遮蔽",
+		"GET /b/(\\d+) (b_digits) 永远不会被匹配, 它被 GET /b/([0-9]+) (b_range) 遮蔽",
+		"GET /c/int:id (c_int) 永远不会被匹配, 它被 GET /c/{id:-?\\d+} (c_custom) 遮蔽",
+		"GET /e/*path/edit (e_edit) 中的通配符 *path 必须位于最后",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "d_str") {
+		t.Fatalf("overlapping but reachable routes should not be reported: %v", err)
+	}
+	if strings.Contains(err.Error(), "create_page") {
+		t.Fatalf("POST route is reachable and should not be reported: %v", err)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	app := newTestApplication()
+	app.Before(func(ctx *Context) (bool, Result) { return true, nil }, "home")
+	app.Get("/", "home", "首页", testHandler(0))
+	bp := NewBlueprint("/admin")
+	bp.Post("/users", "create", "", testHandler(0))
+	app.Blueprint("admin", bp)
+	app.Mount("/debug", http.NotFoundHandler())
+	routes := app.Routes()
+	if len(routes) != 5 {
+		t.Fatalf("expected 5 routes, got %v", routes)
+	}
+	if r := routes[0]; r.Method != "GET" || r.Pattern != "/" || r.Name != "home" || r.CName != "首页" || len(r.Filters) != 1 {
+		t.Fatalf("unexpected route %+v", r)
+	}
+	if r := routes[1]; r.Method != "POST" || r.Pattern != "/admin/users" || r.Name != "admin.create" || r.Blueprint != "admin" {
+		t.Fatalf("unexpected route %+v", r)
+	}
+	if r := routes[2]; !r.Mounted || r.Pattern != "/debug" {
+		t.Fatalf("unexpected route %+v", r)
+	}
+	if !strings.HasPrefix(routes[0].Filters[0], "before ") || !strings.HasSuffix(routes[0].Filters[0], "(except home)") {
+		t.Fatalf("unexpected filter description %q", routes[0].Filters[0])
+	}
+}
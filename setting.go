@@ -22,6 +22,22 @@ type Setting struct {
 	XsrfCookie        string
 	CurrentUser       string
 	Capt              string
+	//末尾斜杠的处理方式:redirect,both或strict,见const.go
+	TrailingSlash string
+	//是否清理路径中的 //、. 和 ..并重定向到规范的路径
+	CleanPath bool
+	//严格模式下模板中的url生成失败时panic,模板渲染随之失败
+	StrictURL bool
+	//请求体的最大字节数,超出时返回413,0表示不限制;可以通过BodyLimit中间件为处理器单独设置
+	MaxBodySize int64
+	//解析multipart表单时使用的最大内存,超出的部分写入临时文件,0表示使用默认的32M
+	MaxMemory int64
+	//Debug模式下json输出使用的缩进,为空时不缩进
+	JsonIndent string
+	//json默认转义<、>和&,设置为true时原样输出
+	JsonUnescapeHTML bool
+	//元素个数不少于该值的切片逐个元素编码并流式输出,0表示不使用
+	JsonStreamThreshold int
 }
 
 var (
@@ -38,16 +54,22 @@ func NewSetting(fileName string) *Setting {
 		file, err := ioutil.ReadFile(filePath)
 		secret := fmt.Sprintf("%x", sha1.New().Sum([]byte(time.Now().Format(time.RFC3339))))[:32]
 		globalSetting := &Setting{
-			Debug:             true,
-			TemplateDir:       "template",
-			StaticDir:         "static",
-			Secret:            secret,
-			FlashCookieName:   "entropy_msg",
-			SessionCookieName: "entropy_session",
-			Xsrf:              true,
-			XsrfCookie:        "entropy_csrf",
-			CurrentUser:       "entropy_user",
-			Capt:              "entropy_capt",
+			Debug:               true,
+			TemplateDir:         "template",
+			StaticDir:           "static",
+			Secret:              secret,
+			FlashCookieName:     "entropy_msg",
+			SessionCookieName:   "entropy_session",
+			Xsrf:                true,
+			XsrfCookie:          "entropy_csrf",
+			CurrentUser:         "entropy_user",
+			Capt:                "entropy_capt",
+			TrailingSlash:       TrailingSlashRedirect,
+			CleanPath:           true,
+			MaxBodySize:         1 << 25,
+			MaxMemory:           defaultMaxMemory,
+			JsonIndent:          "  ",
+			JsonStreamThreshold: 1000,
 		}
 		log.Println("Loaded default setting")
 		if err == nil {
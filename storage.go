@@ -0,0 +1,282 @@
+package entropy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//保存上传文件的存储后端
+type Storage interface {
+	//保存r中的全部内容,name为客户端提供的文件名,返回用于Open和Delete的键
+	Save(name string, r io.Reader) (string, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+//存储中的键不存在
+var ErrStorageNotFound = errors.New("存储中没有找到该文件")
+
+//允许保留的扩展名,其余的扩展名被丢弃
+var safeExtRegexp = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+//生成随机的安全文件名,只保留原始文件名中合法的扩展名
+func safeFilename(name string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if !safeExtRegexp.MatchString(ext) {
+		ext = ""
+	}
+	return hex.EncodeToString(b) + ext, nil
+}
+
+//检查键是否是safeFilename生成的文件名,防止访问存储目录以外的文件
+func checkStorageKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("无效的存储键 %q", key)
+	}
+	return nil
+}
+
+//将文件保存在本地目录中的存储,文件名随机生成
+type LocalStorage struct {
+	Dir string
+}
+
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{Dir: dir}
+}
+
+func (self *LocalStorage) Save(name string, r io.Reader) (string, error) {
+	key, err := safeFilename(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(self.Dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(self.Dir, key)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return key, nil
+}
+
+func (self *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	if err := checkStorageKey(key); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(self.Dir, key))
+	if os.IsNotExist(err) {
+		return nil, ErrStorageNotFound
+	}
+	return f, err
+}
+
+func (self *LocalStorage) Delete(key string) error {
+	if err := checkStorageKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(self.Dir, key))
+	if os.IsNotExist(err) {
+		return ErrStorageNotFound
+	}
+	if err == nil {
+		//没有附属信息时忽略错误
+		os.Remove(filepath.Join(self.Dir, infoFilename(key)))
+	}
+	return err
+}
+
+//将文件保存在内存中的存储,用于测试
+type MemoryStorage struct {
+	files map[string][]byte
+	infos map[string][]byte
+	lock  sync.RWMutex
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string][]byte), infos: make(map[string][]byte)}
+}
+
+func (self *MemoryStorage) Save(name string, r io.Reader) (string, error) {
+	key, err := safeFilename(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	self.lock.Lock()
+	self.files[key] = data
+	self.lock.Unlock()
+	return key, nil
+}
+
+func (self *MemoryStorage) Open(key string) (io.ReadCloser, error) {
+	self.lock.RLock()
+	data, ok := self.files[key]
+	self.lock.RUnlock()
+	if !ok {
+		return nil, ErrStorageNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (self *MemoryStorage) Delete(key string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.files[key]; !ok {
+		return ErrStorageNotFound
+	}
+	delete(self.files, key)
+	delete(self.infos, key)
+	return nil
+}
+
+//存储中的文件数量
+func (self *MemoryStorage) Len() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return len(self.files)
+}
+
+//支持分块追加写入的存储,用于断点续传
+type ChunkStorage interface {
+	Storage
+	//创建一个空文件,返回键
+	Create(name string) (string, error)
+	//在文件末尾追加r中的内容,出错时返回已经写入的字节数
+	Append(key string, r io.Reader) (int64, error)
+	//文件当前的字节数
+	Size(key string) (int64, error)
+	//保存和读取附属于文件的信息(如断点续传的总长度),Delete时一并删除
+	SetInfo(key string, info []byte) error
+	Info(key string) ([]byte, error)
+}
+
+//本地存储中附属信息的文件名
+func infoFilename(key string) string {
+	return key + ".info"
+}
+
+func (self *LocalStorage) Create(name string) (string, error) {
+	return self.Save(name, bytes.NewReader(nil))
+}
+
+func (self *LocalStorage) Append(key string, r io.Reader) (int64, error) {
+	if err := checkStorageKey(key); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(filepath.Join(self.Dir, key), os.O_WRONLY|os.O_APPEND, 0644)
+	if os.IsNotExist(err) {
+		return 0, ErrStorageNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+func (self *LocalStorage) Size(key string) (int64, error) {
+	if err := checkStorageKey(key); err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(filepath.Join(self.Dir, key))
+	if os.IsNotExist(err) {
+		return 0, ErrStorageNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (self *MemoryStorage) Create(name string) (string, error) {
+	return self.Save(name, bytes.NewReader(nil))
+}
+
+func (self *MemoryStorage) Append(key string, r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.files[key]; !ok {
+		return 0, ErrStorageNotFound
+	}
+	self.files[key] = append(self.files[key], data...)
+	return int64(len(data)), err
+}
+
+func (self *MemoryStorage) Size(key string) (int64, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	data, ok := self.files[key]
+	if !ok {
+		return 0, ErrStorageNotFound
+	}
+	return int64(len(data)), nil
+}
+
+func (self *LocalStorage) SetInfo(key string, info []byte) error {
+	if _, err := self.Size(key); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(self.Dir, infoFilename(key)), info, 0644)
+}
+
+func (self *LocalStorage) Info(key string) ([]byte, error) {
+	if err := checkStorageKey(key); err != nil {
+		return nil, err
+	}
+	info, err := ioutil.ReadFile(filepath.Join(self.Dir, infoFilename(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrStorageNotFound
+	}
+	return info, err
+}
+
+func (self *MemoryStorage) SetInfo(key string, info []byte) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.files[key]; !ok {
+		return ErrStorageNotFound
+	}
+	self.infos[key] = append([]byte(nil), info...)
+	return nil
+}
+
+func (self *MemoryStorage) Info(key string) ([]byte, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	info, ok := self.infos[key]
+	if !ok {
+		return nil, ErrStorageNotFound
+	}
+	return info, nil
+}
@@ -0,0 +1,262 @@
+package entropy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//支持的tus协议版本
+const TusVersion = "1.0.0"
+
+//tus断点续传的配置
+type TusConfig struct {
+	//上传文件的最大字节数,0表示不限制
+	MaxSize int64
+	//文件上传完成时在最后一个PATCH请求中调用,返回的错误由InternalServerErrorHandler处理
+	OnComplete func(ctx *Context, file *TusFile) error
+}
+
+//一个通过tus协议上传的文件
+type TusFile struct {
+	//文件在存储中的键,同时作为上传地址的最后一段
+	ID string
+	//文件的总字节数
+	Length int64
+	//已经接收的字节数
+	Offset int64
+	//客户端通过Upload-Metadata提供的信息
+	Metadata map[string]string
+	//原始的Upload-Metadata头,HEAD请求时原样返回
+	rawMetadata string
+	storage     ChunkStorage
+}
+
+//客户端提供的文件名,来自Upload-Metadata中的filename
+func (self *TusFile) Filename() string {
+	return self.Metadata["filename"]
+}
+
+//读取已经接收的内容
+func (self *TusFile) Open() (io.ReadCloser, error) {
+	return self.storage.Open(self.ID)
+}
+
+//通过ChunkStorage.SetInfo保存的上传信息,偏移量即文件在存储中的大小
+type tusInfo struct {
+	Length   int64  `json:"length"`
+	Metadata string `json:"metadata,omitempty"`
+}
+
+//tus协议的服务端,文件内容和上传信息都保存在ChunkStorage中,重启或多个实例共享存储时可以继续上传;
+//内存中只记录正在接收PATCH请求的文件
+type tusServer struct {
+	storage ChunkStorage
+	config  TusConfig
+	busy    map[string]bool
+	lock    sync.Mutex
+}
+
+/*创建实现tus 1.0断点续传协议的Blueprint,支持creation和termination扩展:
+
+	app.Blueprint("uploads", NewTusBlueprint("/files", NewLocalStorage("uploads"), TusConfig{
+		OnComplete: func(ctx *Context, file *TusFile) error { ... },
+	}))
+
+客户端向 /files/ 发送POST请求创建上传,然后通过HEAD查询偏移量,通过PATCH上传分块,通过DELETE取消上传.
+PATCH请求不受Setting.MaxBodySize的限制,但是不能超出文件剩余的字节数
+*/
+func NewTusBlueprint(prefix string, storage ChunkStorage, config TusConfig) *Blueprint {
+	server := &tusServer{storage: storage, config: config, busy: make(map[string]bool)}
+	bp := NewBlueprint(prefix)
+	bp.Around(server.protocol)
+	bp.handle("OPTIONS", "/", "options", "tus配置", server.options, nil)
+	bp.handle("POST", "/", "create", "创建上传", server.create, nil)
+	bp.handle("HEAD", "/:id", "offset", "查询偏移量", server.offset, nil)
+	bp.handle("PATCH", "/:id", "patch", "上传分块", server.patch, []Middleware{BodyLimit(-1, 0)})
+	bp.handle("DELETE", "/:id", "terminate", "取消上传", server.terminate, nil)
+	return bp
+}
+
+//检查协议版本,除OPTIONS外的所有请求必须带有Tus-Resumable头
+func (self *tusServer) protocol(ctx *Context, next func() Result) Result {
+	if ctx.Req.Method != "OPTIONS" {
+		ctx.Resp.Header().Set("Tus-Resumable", TusVersion)
+		if ctx.Req.Header.Get("Tus-Resumable") != TusVersion {
+			ctx.Resp.Header().Set("Tus-Version", TusVersion)
+			return NewStatusResult(ctx, 412)
+		}
+	}
+	return next()
+}
+
+func (self *tusServer) options(ctx *Context) Result {
+	header := ctx.Resp.Header()
+	header.Set("Tus-Resumable", TusVersion)
+	header.Set("Tus-Version", TusVersion)
+	header.Set("Tus-Extension", "creation,termination")
+	if self.config.MaxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(self.config.MaxSize, 10))
+	}
+	return NewStatusResult(ctx, 204)
+}
+
+func (self *tusServer) create(ctx *Context) Result {
+	length, err := strconv.ParseInt(ctx.Req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		ctx.Err = fmt.Errorf("无效的Upload-Length %q", ctx.Req.Header.Get("Upload-Length"))
+		panic(400)
+	}
+	if self.config.MaxSize > 0 && length > self.config.MaxSize {
+		return NewStatusResult(ctx, 413)
+	}
+	rawMetadata := ctx.Req.Header.Get("Upload-Metadata")
+	metadata, err := parseTusMetadata(rawMetadata)
+	if err != nil {
+		ctx.Err = err
+		panic(400)
+	}
+	id, err := self.storage.Create("")
+	if err != nil {
+		panic(err)
+	}
+	info, err := json.Marshal(tusInfo{Length: length, Metadata: rawMetadata})
+	if err == nil {
+		err = self.storage.SetInfo(id, info)
+	}
+	if err != nil {
+		self.storage.Delete(id)
+		panic(err)
+	}
+	file := &TusFile{ID: id, Length: length, Metadata: metadata, rawMetadata: rawMetadata, storage: self.storage}
+	ctx.Resp.Header().Set("Location", path.Join(ctx.Req.URL.Path, id))
+	//空文件在创建时就已经完成
+	if length == 0 {
+		self.complete(ctx, file)
+	}
+	return NewStatusResult(ctx, 201)
+}
+
+func (self *tusServer) offset(ctx *Context, id string) Result {
+	file := self.file(id)
+	header := ctx.Resp.Header()
+	header.Set("Upload-Offset", strconv.FormatInt(file.Offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(file.Length, 10))
+	header.Set("Cache-Control", "no-store")
+	if file.rawMetadata != "" {
+		header.Set("Upload-Metadata", file.rawMetadata)
+	}
+	return NewStatusResult(ctx, 200)
+}
+
+func (self *tusServer) patch(ctx *Context, id string) Result {
+	if ctx.Req.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		return NewStatusResult(ctx, 415)
+	}
+	offset, err := strconv.ParseInt(ctx.Req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		ctx.Err = fmt.Errorf("无效的Upload-Offset %q", ctx.Req.Header.Get("Upload-Offset"))
+		panic(400)
+	}
+	//同一个文件不能同时接收多个PATCH请求;偏移量在加锁之后读取,保证与存储中的大小一致
+	self.lock.Lock()
+	if self.busy[id] {
+		self.lock.Unlock()
+		return NewStatusResult(ctx, 423)
+	}
+	self.busy[id] = true
+	self.lock.Unlock()
+	defer func() {
+		self.lock.Lock()
+		delete(self.busy, id)
+		self.lock.Unlock()
+	}()
+
+	file := self.file(id)
+	if offset != file.Offset {
+		ctx.Resp.Header().Set("Upload-Offset", strconv.FormatInt(file.Offset, 10))
+		return NewStatusResult(ctx, 409)
+	}
+	//超出文件剩余字节数的内容被丢弃,连接中断时保留已经写入的部分
+	n, err := self.storage.Append(id, io.LimitReader(ctx.Req.Body, file.Length-offset))
+	if err != nil && n == 0 {
+		panic(err)
+	}
+	file.Offset += n
+	ctx.Resp.Header().Set("Upload-Offset", strconv.FormatInt(file.Offset, 10))
+	if file.Offset == file.Length {
+		self.complete(ctx, file)
+	}
+	return NewStatusResult(ctx, 204)
+}
+
+func (self *tusServer) terminate(ctx *Context, id string) Result {
+	file := self.file(id)
+	if err := self.storage.Delete(file.ID); err != nil && err != ErrStorageNotFound {
+		panic(err)
+	}
+	return NewStatusResult(ctx, 204)
+}
+
+//从存储中读取上传信息,偏移量为文件当前的大小;不存在时返回404
+func (self *tusServer) file(id string) *TusFile {
+	data, err := self.storage.Info(id)
+	if err == ErrStorageNotFound {
+		panic(404)
+	}
+	if err != nil {
+		panic(err)
+	}
+	var info tusInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		panic(err)
+	}
+	offset, err := self.storage.Size(id)
+	if err == ErrStorageNotFound {
+		panic(404)
+	}
+	if err != nil {
+		panic(err)
+	}
+	//上传信息在创建时已经检查过,这里忽略解析错误
+	metadata, _ := parseTusMetadata(info.Metadata)
+	return &TusFile{ID: id, Length: info.Length, Offset: offset, Metadata: metadata, rawMetadata: info.Metadata, storage: self.storage}
+}
+
+func (self *tusServer) complete(ctx *Context, file *TusFile) {
+	if self.config.OnComplete == nil {
+		return
+	}
+	if err := self.config.OnComplete(ctx, file); err != nil {
+		panic(err)
+	}
+}
+
+//解析Upload-Metadata: 以逗号分隔的键值对,键和值以空格分隔,值使用base64编码并且可以省略
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("无效的Upload-Metadata %q", header)
+		}
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("Upload-Metadata中 %s 的值不是有效的base64: %v", parts[0], err)
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
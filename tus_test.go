@@ -0,0 +1,132 @@
+package entropy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTusUpload(t *testing.T) {
+	storage := NewMemoryStorage()
+	var completed string
+	app := newTestApplication()
+	app.Blueprint("uploads", NewTusBlueprint("/files", storage, TusConfig{
+		MaxSize: 1024,
+		OnComplete: func(ctx *Context, file *TusFile) error {
+			r, err := file.Open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			data, err := ioutil.ReadAll(r)
+			completed = file.Filename() + ":" + string(data)
+			return err
+		},
+	}))
+	do := func(method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", TusVersion)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("OPTIONS", "/files/", "", nil)
+	if rec.Code != 204 || rec.Header().Get("Tus-Version") != TusVersion || rec.Header().Get("Tus-Max-Size") != "1024" {
+		t.Fatalf("unexpected OPTIONS response %d %v", rec.Code, rec.Header())
+	}
+	if rec = do("POST", "/files/", "", map[string]string{"Upload-Length": "4096"}); rec.Code != 413 {
+		t.Fatalf("expected 413 for a file larger than MaxSize, got %d", rec.Code)
+	}
+	rec = do("POST", "/files/", "", map[string]string{"Upload-Length": "11", "Upload-Metadata": "filename aGVsbG8udHh0"})
+	location := rec.Header().Get("Location")
+	if rec.Code != 201 || !strings.HasPrefix(location, "/files/") {
+		t.Fatalf("unexpected creation response %d %q", rec.Code, location)
+	}
+
+	chunk := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}
+	if rec = do("PATCH", location, "hello ", chunk); rec.Code != 204 || rec.Header().Get("Upload-Offset") != "6" {
+		t.Fatalf("unexpected PATCH response %d %v", rec.Code, rec.Header())
+	}
+	if rec = do("PATCH", location, "world", chunk); rec.Code != 409 {
+		t.Fatalf("expected 409 for a stale offset, got %d", rec.Code)
+	}
+	if rec = do("HEAD", location, "", nil); rec.Code != 200 || rec.Header().Get("Upload-Offset") != "6" || rec.Header().Get("Upload-Length") != "11" {
+		t.Fatalf("unexpected HEAD response %d %v", rec.Code, rec.Header())
+	}
+	chunk["Upload-Offset"] = "6"
+	if rec = do("PATCH", location, "world and more", chunk); rec.Code != 204 || rec.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("unexpected PATCH response %d %v", rec.Code, rec.Header())
+	}
+	if completed != "hello.txt:hello world" {
+		t.Fatalf("unexpected completed file %q", completed)
+	}
+
+	req := httptest.NewRequest("HEAD", location, nil)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 without Tus-Resumable, got %d", rec.Code)
+	}
+	if rec = do("DELETE", location, "", nil); rec.Code != 204 || storage.Len() != 0 {
+		t.Fatalf("expected the upload to be terminated, got %d", rec.Code)
+	}
+	if rec = do("HEAD", location, "", nil); rec.Code != 404 {
+		t.Fatalf("expected 404 after termination, got %d", rec.Code)
+	}
+}
+
+func TestTusResumeAcrossServers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "entropy-tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var completed string
+	newApp := func() *Application {
+		app := newTestApplication()
+		app.Blueprint("uploads", NewTusBlueprint("/files", NewLocalStorage(dir), TusConfig{
+			OnComplete: func(ctx *Context, file *TusFile) error {
+				completed = file.Filename()
+				return nil
+			},
+		}))
+		return app
+	}
+	do := func(app *Application, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", TusVersion)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+	first := newApp()
+	location := do(first, "POST", "/files/", "", map[string]string{"Upload-Length": "11", "Upload-Metadata": "filename aGVsbG8udHh0"}).Header().Get("Location")
+	do(first, "PATCH", location, "hello ", map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"})
+
+	//另一个实例(或重启后)从存储中恢复上传信息
+	second := newApp()
+	rec := do(second, "HEAD", location, "", nil)
+	if rec.Code != 200 || rec.Header().Get("Upload-Offset") != "6" || rec.Header().Get("Upload-Length") != "11" || rec.Header().Get("Upload-Metadata") != "filename aGVsbG8udHh0" {
+		t.Fatalf("unexpected HEAD response %d %v", rec.Code, rec.Header())
+	}
+	rec = do(second, "PATCH", location, "world", map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "6"})
+	if rec.Code != 204 || rec.Header().Get("Upload-Offset") != "11" || completed != "hello.txt" {
+		t.Fatalf("unexpected PATCH response %d %v %q", rec.Code, rec.Header(), completed)
+	}
+	if rec = do(second, "DELETE", location, "", nil); rec.Code != 204 {
+		t.Fatalf("expected the upload to be terminated, got %d", rec.Code)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected the file and its info to be removed, found %d files", len(files))
+	}
+}
@@ -0,0 +1,128 @@
+package entropy
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+//一个上传的文件
+type Upload struct {
+	//表单中的字段名
+	Field string
+	//客户端提供的文件名,已经去掉了路径
+	Filename string
+	Size     int64
+	//根据文件内容检测出的MIME类型,不使用客户端提供的Content-Type
+	ContentType string
+	header      *multipart.FileHeader
+}
+
+func newUpload(field string, header *multipart.FileHeader) (*Upload, error) {
+	upload := &Upload{
+		Field:    field,
+		Filename: filepath.Base(strings.Replace(header.Filename, `\`, "/", -1)),
+		Size:     header.Size,
+		header:   header,
+	}
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	//http.DetectContentType最多使用前512个字节
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	upload.ContentType = http.DetectContentType(buf[:n])
+	return upload, nil
+}
+
+//打开文件读取内容
+func (self *Upload) Open() (multipart.File, error) {
+	return self.header.Open()
+}
+
+//小写的扩展名,如 .png
+func (self *Upload) Ext() string {
+	return strings.ToLower(filepath.Ext(self.Filename))
+}
+
+//检查文件大小不超过max字节
+func (self *Upload) CheckSize(max int64) error {
+	if self.Size > max {
+		return fmt.Errorf("文件 %s 的大小为 %d 字节, 超过了 %d 字节的限制", self.Filename, self.Size, max)
+	}
+	return nil
+}
+
+//检查扩展名是否在允许的列表中,如 CheckExt(".jpg", ".png"),不区分大小写
+func (self *Upload) CheckExt(allowed ...string) error {
+	ext := self.Ext()
+	for _, a := range allowed {
+		if strings.ToLower(a) == ext {
+			return nil
+		}
+	}
+	return fmt.Errorf("不允许上传扩展名为 %q 的文件, 允许的扩展名为 %s", ext, strings.Join(allowed, ", "))
+}
+
+//检查检测出的MIME类型是否在允许的列表中,支持 image/* 这样的通配
+func (self *Upload) CheckType(allowed ...string) error {
+	mediaType, _, _ := mime.ParseMediaType(self.ContentType)
+	for _, a := range allowed {
+		if a == mediaType || (strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*"))) {
+			return nil
+		}
+	}
+	return fmt.Errorf("不允许上传类型为 %s 的文件, 允许的类型为 %s", mediaType, strings.Join(allowed, ", "))
+}
+
+//通过存储后端保存文件,返回存储中的键
+func (self *Upload) Save(storage Storage) (string, error) {
+	f, err := self.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return storage.Save(self.Filename, f)
+}
+
+//表单中名为name的第一个文件,没有上传文件时返回http.ErrMissingFile
+func (self *Context) File(name string) (*Upload, error) {
+	uploads, err := self.Files(name)
+	if err != nil {
+		return nil, err
+	}
+	return uploads[0], nil
+}
+
+//表单中名为name的全部文件,没有上传文件时返回http.ErrMissingFile
+func (self *Context) Files(name string) ([]*Upload, error) {
+	if _, err := self.parseBody(); err != nil {
+		return nil, err
+	}
+	return requestUploads(self.Req, name)
+}
+
+func requestUploads(req *http.Request, name string) ([]*Upload, error) {
+	if req.MultipartForm == nil || len(req.MultipartForm.File[name]) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	headers := req.MultipartForm.File[name]
+	uploads := make([]*Upload, 0, len(headers))
+	for _, header := range headers {
+		upload, err := newUpload(name, header)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
@@ -0,0 +1,145 @@
+package entropy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func multipartRequest(t *testing.T, files map[string][]byte) *http.Request {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, content := range files {
+		part, err := w.CreateFormFile("avatar", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(content)
+	}
+	w.WriteField("name", "frank")
+	w.Close()
+	req := httptest.NewRequest("POST", "/upload", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestContextFile(t *testing.T) {
+	ctx := &Context{Req: multipartRequest(t, map[string][]byte{`C:\photos\Me.PNG`: pngHeader})}
+	upload, err := ctx.File("avatar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Filename != "Me.PNG" || upload.Ext() != ".png" || upload.ContentType != "image/png" {
+		t.Fatalf("unexpected upload %+v", upload)
+	}
+	if upload.CheckExt(".jpg", ".png") != nil || upload.CheckType("image/*") != nil || upload.CheckSize(1024) != nil {
+		t.Fatal("expected the upload to pass the checks")
+	}
+	if upload.CheckExt(".gif") == nil || upload.CheckType("text/plain") == nil || upload.CheckSize(4) == nil {
+		t.Fatal("expected the upload to fail the checks")
+	}
+	if _, err := ctx.File("missing"); err != http.ErrMissingFile {
+		t.Fatalf("expected http.ErrMissingFile, got %v", err)
+	}
+
+	storage := NewMemoryStorage()
+	key, err := upload.Save(storage)
+	if err != nil || !strings.HasSuffix(key, ".png") || strings.Contains(key, "Me") {
+		t.Fatalf("unexpected key %q %v", key, err)
+	}
+	r, err := storage.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, pngHeader) {
+		t.Fatalf("unexpected content %q", data)
+	}
+	if storage.Delete(key) != nil || storage.Len() != 0 {
+		t.Fatal("expected the file to be deleted")
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir())
+	key, err := storage.Save("../../etc/passwd.TXT", strings.NewReader("hello"))
+	if err != nil || !strings.HasSuffix(key, ".txt") || strings.Contains(key, "/") {
+		t.Fatalf("unexpected key %q %v", key, err)
+	}
+	r, err := storage.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "hello" {
+		t.Fatalf("unexpected content %q", data)
+	}
+	if _, err := storage.Open("../" + key); err == nil {
+		t.Fatal("expected keys with a path to be rejected")
+	}
+	if storage.Delete(key) != nil {
+		t.Fatal("expected the file to be deleted")
+	}
+	if _, err := storage.Open(key); err != ErrStorageNotFound {
+		t.Fatalf("expected ErrStorageNotFound, got %v", err)
+	}
+}
+
+func TestFileField(t *testing.T) {
+	newForm := func() *Form {
+		return NewForm(NewFileField("avatar", "头像", FileRequired{}, FileExt{".png"}, FileType{"image/*"}))
+	}
+	form := ParseForm(newForm(), multipartRequest(t, map[string][]byte{"me.png": pngHeader}))
+	if !form.Validate() || form.Value("avatar") != "me.png" {
+		t.Fatalf("unexpected errors %v", form.Errors())
+	}
+	form = ParseForm(newForm(), multipartRequest(t, map[string][]byte{"me.png": []byte("plain text")}))
+	if form.Validate() || len(form.Errors()["avatar"]) != 1 {
+		t.Fatalf("expected a type error, got %v", form.Errors())
+	}
+	form = ParseForm(newForm(), multipartRequest(t, nil))
+	if form.Validate() || len(form.Errors()["avatar"]) != 1 {
+		t.Fatalf("expected a required error, got %v", form.Errors())
+	}
+}
+
+func TestContextParseFormLimits(t *testing.T) {
+	app := newTestApplication()
+	app.Setting.MaxBodySize = 64
+	app.Setting.MaxMemory = 1
+	var onDisk bool
+	handler := func(ctx *Context) Result {
+		form := ctx.ParseForm(NewForm(NewFileField("avatar", "头像", FileRequired{})))
+		if !form.Validate() {
+			return NewStatusResult(ctx, 422)
+		}
+		f, err := ctx.Req.MultipartForm.File["avatar"][0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, onDisk = f.(*os.File)
+		f.Close()
+		return NewTextResult(ctx, form.Value("avatar"))
+	}
+	app.Post("/small", "small", "", handler)
+	app.Post("/large", "large", "", handler, BodyLimit(1<<20, 0))
+	for path, code := range map[string]int{"/small": 413, "/large": 200} {
+		req := multipartRequest(t, map[string][]byte{"me.png": pngHeader})
+		req.URL.Path = path
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Fatalf("%s: expected %d, got %d", path, code, rec.Code)
+		}
+	}
+	if !onDisk {
+		t.Fatal("expected the upload to be written to disk because of Setting.MaxMemory")
+	}
+}
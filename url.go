@@ -1,15 +1,112 @@
 package entropy
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
+	neturl "net/url"
 	//"reflect"
 	//"log"
 	"regexp"
+	"regexp/syntax"
 	"strconv"
 	"strings"
 )
 
+//路径参数的类型及其对应的正则表达式,可以向其中添加自定义类型
+var PathConverters = map[string]string{
+	"str":   `\w+`,
+	"int":   `-?[0-9]+`,
+	"float": `-?[0-9]+(?:\.[0-9]+)?`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"slug":  `[A-Za-z0-9_]+(?:-[A-Za-z0-9_]+)*`,
+	"path":  `.+`,
+}
+
+//匹配路径中的参数: {id:[0-9]{4}} 自定义正则, int:id 带类型, :id 字符串, *path 通配
+var paramTokenRegexp = regexp.MustCompile(`\{(\w+):((?:[^{}]|\{[^{}]*\})+)\}|(\w*):(\w+)|\*(\w+)`)
+
+//路径中的一个参数
+type pathParam struct {
+	Name string
+	//类型名,自定义正则时为空
+	Type string
+	//该参数需要匹配的正则表达式
+	Regex string
+	//参数在路径中的位置
+	start, end int
+}
+
+//解析路径中的参数,未知的类型前缀按普通文本处理,如 user:id 等价于 user 后面跟着 :id
+func parsePathParams(pattern string) []pathParam {
+	params := make([]pathParam, 0)
+	for _, m := range paramTokenRegexp.FindAllStringSubmatchIndex(pattern, -1) {
+		p := pathParam{start: m[0], end: m[1]}
+		switch {
+		case m[2] >= 0:
+			p.Name, p.Regex = pattern[m[2]:m[3]], pattern[m[4]:m[5]]
+		case m[10] >= 0:
+			p.Name, p.Type = pattern[m[10]:m[11]], "path"
+		default:
+			p.Name, p.Type = pattern[m[8]:m[9]], pattern[m[6]:m[7]]
+			if _, ok := PathConverters[p.Type]; !ok {
+				p.start += len(p.Type)
+				p.Type = "str"
+			}
+			if p.Type == "" {
+				p.Type = "str"
+			}
+		}
+		if p.Type != "" {
+			p.Regex = PathConverters[p.Type]
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+//将路径中的参数替换为命名分组,其余部分原样保留
+func pathToRegexp(pattern string) string {
+	var buf strings.Builder
+	last := 0
+	for _, p := range parsePathParams(pattern) {
+		buf.WriteString(pattern[last:p.start])
+		buf.WriteString("(?P<" + p.Name + ">" + p.Regex + ")")
+		last = p.end
+	}
+	buf.WriteString(pattern[last:])
+	return buf.String()
+}
+
+//正则中传给处理器的分组,按出现的顺序返回分组的序号和名字:路径参数对应命名分组;
+//原始正则中的无名分组(如 /article/(\d+))同样传给处理器,按在参数中的位置命名为$1、$2...;
+//参数正则内部的分组(如 {id:(a|b)})属于参数本身,不单独传递
+func captureGroups(re *regexp.Regexp) ([]int, []string) {
+	indexes, names := make([]int, 0), make([]string, 0)
+	tree, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return indexes, names
+	}
+	var walk func(r *syntax.Regexp)
+	walk = func(r *syntax.Regexp) {
+		if r.Op == syntax.OpCapture {
+			name := r.Name
+			if name == "" {
+				name = "$" + strconv.Itoa(len(names)+1)
+			}
+			indexes, names = append(indexes, r.Cap), append(names, name)
+			if r.Name != "" {
+				return
+			}
+		}
+		for _, sub := range r.Sub {
+			walk(sub)
+		}
+	}
+	walk(tree)
+	return indexes, names
+}
+
 //一个URL标识
 type URLSpec struct {
 	//开发者设置的路径
@@ -22,6 +119,14 @@ type URLSpec struct {
 	Name string
 	//中文名称
 	CName string
+	//HTTP方法,空字符串表示接受任意方法
+	Method string
+	//路径中参数的名字,按出现的顺序排列,原始正则中的无名分组为$1、$2...
+	ParamNames []string
+	//只作用于该处理器的中间件
+	Middlewares []Middleware
+	//处理器的调用计划,注册处理器时生成
+	plan *handlerPlan
 }
 
 //URLSpec的构造函数
@@ -33,59 +138,118 @@ func NewURLSpec(pattern string, handler Handler, ename string, cname string) *UR
 	if err != nil {
 		panic(err)
 	}
+	_, spec.ParamNames = captureGroups(spec.Regex)
 	return spec
 }
 
-//将 /:path/:action/:id 这样的路径转为正则表达式 :/(\w+)/(\w+)/(\w+)
+//检查处理器的签名并生成调用计划,签名不正确时panic
+func (self *URLSpec) mustPlan() {
+	plan, err := newHandlerPlan(self)
+	if err != nil {
+		panic(err.Error())
+	}
+	self.plan = plan
+}
+
+//将 /:path/int:id/{year:[0-9]{4}} 这样的路径转为正则表达式 /(?P<path>\w+)/(?P<id>-?[0-9]+)/(?P<year>[0-9]{4})
 func (self *URLSpec) Url2Regexp() (exp *regexp.Regexp, err error) {
-	paramRegexp, _ := regexp.Compile(`:\w+`)
-	tmp := paramRegexp.ReplaceAllString(self.Pattern, `(\w+)`)
-	exp, err = regexp.Compile(tmp)
+	exp, err = regexp.Compile(pathToRegexp(self.Pattern))
 	return
 }
 
-//将用户实际访问路径中提供的变量值替换到原始路径中 ，url：/home/:name/:id/:newId, vars ...interface{}
+//将参数按顺序替换到原始路径中并进行转义 ，url：/home/:name/:id/:newId, vars ...interface{}
 func (self *URLSpec) UrlSetParams(args ...interface{}) (url string, err error) {
-	url = self.Pattern
-	if strings.HasSuffix(url, "$") {
-		url = strings.TrimSuffix(url, "$")
-	}
-	exp, _ := regexp.Compile(`(:\w+)`)
-	matched := exp.FindAllString(self.Pattern, -1)
-	if len(matched) != len(args) {
-		err = errors.New(fmt.Sprintf("严重错误:该处理器需要 %d 个参数 , 但是提供了 %d 个参数.", len(matched), len(args)))
+	params := parsePathParams(self.path())
+	if len(params) != len(args) {
+		err = errors.New(fmt.Sprintf("严重错误:该处理器需要 %d 个参数 , 但是提供了 %d 个参数.", len(params), len(args)))
 		return
-	} else {
-		for index, arg := range args {
-			if s, ok := arg.(string); ok {
-				url = strings.Replace(url, matched[index], s, -1)
-			} else if i, ok := arg.(int64); ok {
-				url = strings.Replace(url, matched[index], strconv.FormatInt(i, 10), -1)
-			} else if i, ok := arg.(int); ok {
-				url = strings.Replace(url, matched[index], strconv.FormatInt(int64(i), 10), -1)
-			} else {
-				err = errors.New(fmt.Sprintf("参数%v须为string或int(int64)类型", arg))
-				return
-			}
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		if values[i], err = formatParam(arg); err != nil {
+			return
+		}
+	}
+	return self.fill(params, values)
+}
 
+//按参数的名字生成路径,缺少参数时返回错误,多余的参数被忽略
+func (self *URLSpec) Build(args map[string]interface{}) (url string, err error) {
+	params := parsePathParams(self.path())
+	values := make([]string, len(params))
+	for i, p := range params {
+		arg, ok := args[p.Name]
+		if !ok {
+			err = errors.New(fmt.Sprintf("处理器 %s 缺少参数 %s", self.Name, p.Name))
+			return
+		}
+		if values[i], err = formatParam(arg); err != nil {
+			return
 		}
-		return url, nil
 	}
+	return self.fill(params, values)
+}
+
+//去掉^和$后的原始路径
+func (self *URLSpec) path() string {
+	return strings.TrimSuffix(strings.TrimPrefix(self.Pattern, "^"), "$")
+}
+
+//检查参数是否匹配其类型,转义后从后往前替换,保证前面参数的位置不变
+func (self *URLSpec) fill(params []pathParam, values []string) (string, error) {
+	url := self.path()
+	for index := len(params) - 1; index >= 0; index-- {
+		p, value := params[index], values[index]
+		if !regexp.MustCompile("^(?:" + p.Regex + ")$").MatchString(value) {
+			return "", errors.New(fmt.Sprintf("参数 %s 的值 %q 与 %s 不匹配", p.Name, value, p.Regex))
+		}
+		url = url[:p.start] + escapeParam(p, value) + url[p.end:]
+	}
+	return url, nil
+}
+
+//转义路径参数,通配参数中的/保留
+func escapeParam(p pathParam, value string) string {
+	if p.Type != "path" {
+		return neturl.PathEscape(value)
+	}
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		segments[i] = neturl.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+//将参数格式化为字符串,支持字符串、数字、布尔值以及实现了encoding.TextMarshaler或fmt.Stringer的类型
+func formatParam(arg interface{}) (string, error) {
+	switch v := arg.(type) {
+	case string:
+		return v, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool:
+		return fmt.Sprint(v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		return string(text), err
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	return "", errors.New(fmt.Sprintf("参数%v的类型%T无法转为路径参数", arg, arg))
 }
 
 //To transform /home/aaa/bbb (/home/:p1/:p2) into []string   :(\w+):
 func (self *URLSpec) ParseUrlParams(url string) (args []string) {
-	paramValues := self.Regex.FindStringSubmatch(url)[1:]
 	args = make([]string, 0)
-	//paramNameRegexp, _ := regexp.Compile(`(:\w+)`)
-	parttens := strings.Split(self.Pattern, "/")
-	var index int = 0
-	for _, p := range parttens {
-		if strings.HasPrefix(p, ":") {
-			//pName := paramNameRegexp.FindStringSubmatch(p)[1]
-			args = append(args, paramValues[index])
-			index++
-		}
+	values := self.Regex.FindStringSubmatch(url)
+	if values == nil {
+		return
+	}
+	indexes, _ := captureGroups(self.Regex)
+	for _, i := range indexes {
+		args = append(args, values[i])
 	}
 	return
 }
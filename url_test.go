@@ -1,7 +1,14 @@
 package entropy
 
 import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -34,3 +41,85 @@ func TestParseUrlParams(t *testing.T) {
 	args := spec.ParseUrlParams("/home/frank/yang")
 	t.Logf("%v", args)
 }
+
+func TestTypedUrlParams(t *testing.T) {
+	spec := NewURLSpec("/blog/{year:[0-9]{4}}/int:id/:slug", reflect.ValueOf(&TestHandler{}), "ename", "cname")
+	args := spec.ParseUrlParams("/blog/2014/12/hello")
+	if len(args) != 3 || args[0] != "2014" || args[1] != "12" || args[2] != "hello" {
+		t.Fatalf("%v", args)
+	}
+	url, err := spec.UrlSetParams("2014", 12, "hello")
+	if err != nil || url != "/blog/2014/12/hello" {
+		t.Fatalf("%v %v", url, err)
+	}
+}
+
+func TestReverseURL(t *testing.T) {
+	app := newTestApplication()
+	app.Get("^/files/path:file$", "file", "", testHandler(1))
+	app.Get("/users/int:id", "user", "", testHandler(1))
+	bp := NewBlueprint("/")
+	bp.Host = "{tenant}.example.com"
+	bp.Get("/", "home", "", testHandler(1))
+	app.Blueprint("tenant", bp)
+
+	spec := app.NamedHandlers["file"]
+	if url, err := spec.UrlSetParams("docs/a b.txt"); err != nil || url != "/files/docs/a%20b.txt" {
+		t.Fatalf("%v %v", url, err)
+	}
+	if _, err := app.NamedHandlers["user"].UrlSetParams("abc"); err == nil {
+		t.Fatal("expected an error for a value that does not match int")
+	}
+
+	url, err := app.URLFor("user", URLOptions{
+		Params:   map[string]interface{}{"id": 7, "tab": "posts"},
+		Query:    map[string][]string{"page": {"2"}},
+		Fragment: "top",
+	})
+	if err != nil || url != "/users/7?page=2&tab=posts#top" {
+		t.Fatalf("%v %v", url, err)
+	}
+	if _, err := app.URLFor("user", URLOptions{}); err == nil {
+		t.Fatal("expected an error for a missing parameter")
+	}
+	if _, err := app.URLFor("nothing", URLOptions{}); err == nil {
+		t.Fatal("expected an error for an unknown handler")
+	}
+
+	ctx := &Context{App: app, Req: httptest.NewRequest("GET", "https://www.example.com/", nil)}
+	if url, err := ctx.URLFor("user", URLOptions{Params: map[string]interface{}{"id": 7}, Absolute: true}); err != nil || url != "https://www.example.com/users/7" {
+		t.Fatalf("%v %v", url, err)
+	}
+	if url, err := ctx.URLFor("tenant.home", URLOptions{Params: map[string]interface{}{"tenant": "acme"}}); err != nil || url != "https://acme.example.com/" {
+		t.Fatalf("%v %v", url, err)
+	}
+	for _, tenant := range []string{"evil.com/x?", "evil.com#", "evil@", ""} {
+		if url, err := app.URLFor("tenant.home", URLOptions{Params: map[string]interface{}{"tenant": tenant}}); err == nil {
+			t.Fatalf("expected an error for tenant %q, got %q", tenant, url)
+		}
+	}
+	if url, err := ctx.Reverse("tenant.home", "evil.com#"); err == nil {
+		t.Fatalf("expected an error for an injected host, got %q", url)
+	}
+
+	//使用Initialize注册的模板函数,不需要模板目录
+	app.initTemplateFuncs()
+	tpl := template.Must(template.New("").Funcs(app.TplFuncs).Parse(`{{urlfor "user"}}|{{url "user"}}|{{urlfor "user" "id" 7}}`))
+	var buf bytes.Buffer
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	if err := tpl.Execute(&buf, nil); err != nil || buf.String() != "||/users/7" {
+		t.Fatalf("expected empty urls outside strict mode, got %q %v", buf.String(), err)
+	}
+	if strings.Count(logs.String(), "生成 user 的url失败") != 2 {
+		t.Fatalf("expected the failures to be logged, got %q", logs.String())
+	}
+	app.Setting.StrictURL = true
+	for _, text := range []string{`{{urlfor "user"}}`, `{{url "user"}}`, `{{urlfor "user" "id"}}`} {
+		tpl := template.Must(template.New("").Funcs(app.TplFuncs).Parse(text))
+		if err := tpl.Execute(ioutil.Discard, nil); err == nil {
+			t.Fatalf("%s: expected template execution to fail in strict mode", text)
+		}
+	}
+}